@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	validator "gopkg.in/go-playground/validator.v9"
+
+	"github.com/signalfx/signalfx-agent/internal/utils"
 )
 
 // Validatable should be implemented by config structs that want to provide
@@ -29,7 +31,7 @@ func ValidateStruct(confStruct interface{}) error {
 	validate := validator.New()
 	err := validate.Struct(confStruct)
 	if err != nil {
-		return err
+		return &Error{error: err, confStruct: confStruct}
 	}
 	return nil
 }
@@ -37,16 +39,44 @@ func ValidateStruct(confStruct interface{}) error {
 // Error wraps an error and formats it properly
 type Error struct {
 	error
+	// confStruct is the struct that was being validated when the error
+	// occurred, so field names can be translated to their yaml tags.
+	confStruct interface{}
 }
 
 func (e *Error) Error() string {
 	if ves, ok := e.error.(validator.ValidationErrors); ok {
 		var msgs []string
 		for _, ve := range ves {
-			fieldName := utils.YAMLNameOfFieldInStruct(ve.Field(), confStruct)
+			fieldName := utils.YAMLNameOfFieldInStruct(ve.Field(), e.confStruct)
 			msgs = append(msgs, fmt.Sprintf("Validation error in field '%s': %s", fieldName, ve.Tag()))
 		}
 		return strings.Join(msgs, "; ")
 	}
 	return e.error.Error()
 }
+
+// WithoutRequiredViolationsFor returns an error equivalent to e but with
+// any `required` tag violations dropped for the given set of Go field
+// names, or nil if nothing is left. Used to validate configs whose
+// endpoint-derived fields (Host/Port) aren't populated yet because they
+// come from a discovery rule instead of static config.
+func (e *Error) WithoutRequiredViolationsFor(fieldNames map[string]bool) error {
+	ves, ok := e.error.(validator.ValidationErrors)
+	if !ok {
+		return e
+	}
+
+	var remaining validator.ValidationErrors
+	for _, ve := range ves {
+		if ve.Tag() == "required" && fieldNames[ve.Field()] {
+			continue
+		}
+		remaining = append(remaining, ve)
+	}
+
+	if len(remaining) == 0 {
+		return nil
+	}
+	return &Error{error: remaining, confStruct: e.confStruct}
+}
@@ -0,0 +1,38 @@
+package validation
+
+import "testing"
+
+type hostPortConfig struct {
+	Host string `validate:"required"`
+	Port uint16 `validate:"required"`
+	Name string `validate:"required"`
+}
+
+// TestWithoutRequiredViolationsForDiscoveryFields exercises the scenario
+// validateConfigWithDiscoveryRule relies on: a config with required Host
+// and Port left unset (as happens ahead of discovery) still surfaces an
+// unrelated required-field violation, while the Host/Port violations
+// themselves are suppressed.
+func TestWithoutRequiredViolationsForDiscoveryFields(t *testing.T) {
+	conf := &hostPortConfig{}
+
+	err := ValidateStruct(conf)
+	if err == nil {
+		t.Fatal("expected a validation error for an empty config")
+	}
+
+	filtered := err.(*Error).WithoutRequiredViolationsFor(map[string]bool{"Host": true, "Port": true})
+	if filtered == nil {
+		t.Fatal("expected the unrelated Name violation to survive filtering")
+	}
+	if got := filtered.Error(); got == "" {
+		t.Fatalf("expected a non-empty error message, got %q", got)
+	}
+
+	conf.Name = "test"
+	err = ValidateStruct(conf)
+	filtered = err.(*Error).WithoutRequiredViolationsFor(map[string]bool{"Host": true, "Port": true})
+	if filtered != nil {
+		t.Fatalf("expected filtering out Host/Port violations to leave nil, got %v", filtered)
+	}
+}
@@ -4,17 +4,28 @@ import (
 	"errors"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/signalfx/golib/datapoint"
+	"github.com/signalfx/golib/sfxclient"
 	k8sutil "github.com/signalfx/signalfx-agent/internal/monitors/kubernetes/utils"
 	atypes "github.com/signalfx/signalfx-agent/internal/monitors/types"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
-	"k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sync"
 )
 
+// nodeDisruptionCacheKey and namespaceDisruptionCacheKey are synthetic
+// dpCache keys (no real K8s object has these UIDs) under which the
+// rolling per-node/per-namespace eviction and OOM-kill counters are
+// stored, so AllDatapoints picks them up alongside ordinary resource
+// datapoints without any special-casing.
+const (
+	nodeDisruptionCacheKey      = types.UID("_kubernetes_disruption_counts_by_node")
+	namespaceDisruptionCacheKey = types.UID("_kubernetes_disruption_counts_by_namespace")
+)
+
 // ContainerID is some type of unique id for containers
 type ContainerID string
 
@@ -22,6 +33,20 @@ var logger = log.WithFields(log.Fields{
 	"monitorType": "kubernetes-cluster",
 })
 
+// ownerPropertyForKind maps the Kind of a workload resource to the dim
+// property name used to record a pod's ancestry through it, so
+// setOwnerPropsForPod can translate an owner chain (see
+// k8sutil.OwnerCache.OwnerChain) directly into dim properties in O(depth),
+// without scanning every other cached resource.
+var ownerPropertyForKind = map[string]string{
+	"Deployment":  "deployment",
+	"ReplicaSet":  "replicaSet",
+	"StatefulSet": "statefulSet",
+	"DaemonSet":   "daemonSet",
+	"Job":         "job",
+	"CronJob":     "cronJob",
+}
+
 // DatapointCache holds an up to date copy of datapoints pertaining to the
 // cluster.  It is updated whenever the HandleAdd method is called with new
 // K8s resources.
@@ -31,18 +56,62 @@ type DatapointCache struct {
 	dimPropCache    map[types.UID]*atypes.DimProperties
 	uidKindCache    map[types.UID]string
 	podServiceCache *k8sutil.PodServiceCache
+	podCache        *k8sutil.PodCache
+	ownerCache      *k8sutil.OwnerCache
+	handlerRegistry *ResourceHandlerRegistry
 	useNodeName     bool
+	shardConfig     ShardConfig
+
+	// podRootOwner tracks, for each pod currently cached, the UID its
+	// owner chain currently resolves up to (its own UID if it has no
+	// known owner yet). pendingRootOwner is the reverse index: for each
+	// such root UID, the pods waiting on it. When a workload resource
+	// (e.g. a Deployment) is added after its children, pendingRootOwner
+	// lets us backfill just the affected pods instead of rescanning the
+	// whole cache.
+	podRootOwner     map[types.UID]types.UID
+	pendingRootOwner map[types.UID]map[types.UID]bool
+
+	// evictedPods and oomKilledContainers dedupe the disruption events
+	// already folded into nodeEvictionCounts/namespaceEvictionCounts and
+	// nodeOOMKillCounts/namespaceOOMKillCounts, since HandleAdd re-fires
+	// on every resync of a pod that's already been counted.
+	evictedPods             map[types.UID]bool
+	oomKilledContainers     map[string]bool
+	nodeEvictionCounts      map[string]int64
+	namespaceEvictionCounts map[string]int64
+	nodeOOMKillCounts       map[string]int64
+	namespaceOOMKillCounts  map[string]int64
+
+	// restoredUIDs holds the UIDs loaded by Restore that haven't been
+	// re-confirmed by a HandleAdd call yet; see PruneUnconfirmedRestored.
+	restoredUIDs map[types.UID]bool
 }
 
 // NewDatapointCache creates a new clean cache
 func NewDatapointCache(useNodeName bool) *DatapointCache {
-	return &DatapointCache{
-		dpCache:         make(map[types.UID][]*datapoint.Datapoint),
-		dimPropCache:    make(map[types.UID]*atypes.DimProperties),
-		uidKindCache:    make(map[types.UID]string),
-		podServiceCache: k8sutil.NewPodServiceCache(),
-		useNodeName:     useNodeName,
+	dc := &DatapointCache{
+		dpCache:          make(map[types.UID][]*datapoint.Datapoint),
+		dimPropCache:     make(map[types.UID]*atypes.DimProperties),
+		uidKindCache:     make(map[types.UID]string),
+		podServiceCache:  k8sutil.NewPodServiceCache(),
+		podCache:         k8sutil.NewPodCache(),
+		ownerCache:       k8sutil.NewOwnerCache(),
+		handlerRegistry:  NewResourceHandlerRegistry(),
+		podRootOwner:     make(map[types.UID]types.UID),
+		pendingRootOwner: make(map[types.UID]map[types.UID]bool),
+
+		evictedPods:             make(map[types.UID]bool),
+		oomKilledContainers:     make(map[string]bool),
+		nodeEvictionCounts:      make(map[string]int64),
+		namespaceEvictionCounts: make(map[string]int64),
+		nodeOOMKillCounts:       make(map[string]int64),
+		namespaceOOMKillCounts:  make(map[string]int64),
+
+		useNodeName: useNodeName,
 	}
+	dc.podServiceCache.AddEventHandler(dc)
+	return dc
 }
 
 func keyForObject(obj runtime.Object) (types.UID, error) {
@@ -65,6 +134,8 @@ func (dc *DatapointCache) DeleteByKey(key interface{}) {
 		dc.handleDeletePod(cacheKey)
 	case "Service":
 		dc.handleDeleteService(cacheKey)
+	case "ReplicaSet", "Deployment", "DaemonSet", "StatefulSet", "Job", "CronJob":
+		dc.ownerCache.DeleteByKey(cacheKey)
 	}
 
 	delete(dc.uidKindCache, cacheKey)
@@ -90,47 +161,20 @@ func (dc *DatapointCache) HandleDelete(oldObj runtime.Object) interface{} {
 // HandleAdd accepts a new (or updated) object and updates the datapoint/prop
 // cache as needed.  MUST HOLD LOCK!!
 func (dc *DatapointCache) HandleAdd(newObj runtime.Object) interface{} {
-	var dps []*datapoint.Datapoint
-	var dimProps *atypes.DimProperties
-	var kind string
-
-	switch o := newObj.(type) {
-	case *v1.Pod:
-		dps, dimProps = dc.handleAddPod(o)
-		kind = "Pod"
-	case *v1.Namespace:
-		dps = datapointsForNamespace(o)
-		kind = "Namespace"
-	case *v1.ReplicationController:
-		dps = datapointsForReplicationController(o)
-		kind = "ReplicationController"
-	case *v1beta1.DaemonSet:
-		dps = datapointsForDaemonSet(o)
-		kind = "DaemonSet"
-	case *v1beta1.Deployment:
-		dps = datapointsForDeployment(o)
-		dimProps = dimPropsForDeployment(o)
-		kind = "Deployment"
-	case *v1beta1.ReplicaSet:
-		dps = datapointsForReplicaSet(o)
-		dimProps = dimPropsForReplicaSet(o)
-		kind = "ReplicaSet"
-	case *v1.ResourceQuota:
-		dps = datapointsForResourceQuota(o)
-		kind = "ResourceQuota"
-	case *v1.Node:
-		dps = datapointsForNode(o, dc.useNodeName)
-		dimProps = dimPropsForNode(o, dc.useNodeName)
-		kind = "Node"
-	case *v1.Service:
-		dc.handleAddService(o)
-		kind = "Service"
-	default:
+	kind, dps, dimProps, err, ok := dc.handlerRegistry.Handle(dc, newObj)
+	if !ok {
 		log.WithFields(log.Fields{
 			"obj": spew.Sdump(newObj),
 		}).Error("Unknown object type in HandleAdd")
 		return nil
 	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"obj":   spew.Sdump(newObj),
+		}).Error("Resource handler failed in HandleAdd")
+		return nil
+	}
 
 	key, err := keyForObject(newObj)
 	if err != nil {
@@ -141,70 +185,33 @@ func (dc *DatapointCache) HandleAdd(newObj runtime.Object) interface{} {
 		return nil
 	}
 
-	if dps != nil {
-		dc.dpCache[key] = dps
-	}
+	// uidKindCache is kept up to date regardless of sharding: it's what
+	// DeleteByKey uses to route cleanup of the cheap, cluster-wide
+	// bookkeeping caches (podCache, ownerCache, ...) that other shards'
+	// pods may depend on to resolve their ancestry. Only the
+	// dpCache/dimPropCache payload -- the expensive part this feature
+	// exists to cut down -- is restricted to what this shard owns.
 	if kind != "" {
 		dc.uidKindCache[key] = kind
 	}
-	if dimProps != nil {
-		dc.addDimPropsToCache(key, dimProps)
-	}
-
-	return key
-}
-
-type propertyLink struct {
-	SourceProperty string
-	SourceKind     string
-	SourceJoinKey  string
-	TargetProperty string
-	TargetKind     string
-	TargetJoinKey  string
-}
-
-// addDimPropsToCache maps and syncs properties from different resources together and adds
-// them to the cache
-func (dc *DatapointCache) addDimPropsToCache(key types.UID, dimProps *atypes.DimProperties) {
-	links := []propertyLink{
-		// TODO: disable linking until we figure out a more efficient way of
-		// doing this.  This DOESN'T scale with 1000s of pods/resources.
-		//propertyLink{
-		//	SourceKind:     "ReplicaSet",
-		//	SourceProperty: "deployment",
-		//	SourceJoinKey:  "name",
-		//	TargetKind:     "Pod",
-		//	TargetProperty: "deployment",
-		//	TargetJoinKey:  "replicaSet",
-		//},
-	}
-
-	for _, link := range links {
-		if dc.uidKindCache[key] == link.TargetKind {
-			for cachedKey := range dc.dimPropCache {
-				if dc.uidKindCache[cachedKey] == link.SourceKind {
-					cachedProps := dc.dimPropCache[cachedKey].Properties
-					if cachedProps[link.SourceJoinKey] != "" &&
-						cachedProps[link.SourceJoinKey] == dimProps.Properties[link.TargetJoinKey] {
-						dimProps.Properties[link.TargetProperty] = cachedProps[link.SourceProperty]
-					}
-				}
-			}
+	if dc.owns(key) {
+		if dps != nil {
+			dc.dpCache[key] = dps
 		}
-		if dc.uidKindCache[key] == link.SourceKind {
-			for cachedKey := range dc.dimPropCache {
-				if dc.uidKindCache[cachedKey] == link.TargetKind {
-					cachedProps := dc.dimPropCache[cachedKey].Properties
-					if cachedProps[link.TargetJoinKey] != "" &&
-						cachedProps[link.TargetJoinKey] == dimProps.Properties[link.SourceJoinKey] {
-						cachedProps[link.TargetProperty] = dimProps.Properties[link.SourceProperty]
-					}
-				}
-			}
+		if dimProps != nil {
+			dc.dimPropCache[key] = dimProps
 		}
 	}
+	delete(dc.restoredUIDs, key)
+
+	// Pods that arrived before this resource may have been waiting on it
+	// to resolve their deployment/replicaSet/statefulSet/daemonSet/job/
+	// cronJob properties; backfill just those pods now that it's here.
+	if _, isWorkloadOwner := ownerPropertyForKind[kind]; isWorkloadOwner {
+		dc.backfillPendingPods(key)
+	}
 
-	dc.dimPropCache[key] = dimProps
+	return key
 }
 
 // addPropertiesToDimProps adds/updates new properties to the DimProps cache
@@ -268,8 +275,10 @@ func (dc *DatapointCache) AllDimProperties() []*atypes.DimProperties {
 }
 
 // handleAddPod gets datapoints and dim props for a pod object, and adds
-// the pod to the service:pod cache. If a service is matched, adds the
-// service property to the pod.
+// the pod to the service:pod and owner caches. If a service is matched,
+// adds the service property to the pod, and the pod's owner chain is
+// walked to populate deployment/replicaSet/statefulSet/daemonSet/job/
+// cronJob properties.
 func (dc *DatapointCache) handleAddPod(pod *v1.Pod) ([]*datapoint.Datapoint,
 	*atypes.DimProperties) {
 	dps := datapointsForPod(pod)
@@ -279,47 +288,232 @@ func (dc *DatapointCache) handleAddPod(pod *v1.Pod) ([]*datapoint.Datapoint,
 	if err == nil {
 		dimProps.Properties["service"] = service
 	}
+
+	dc.podCache.AddPod(pod)
+	dc.setOwnerPropsForPod(pod.UID, dimProps.Properties)
+	dc.recordPodDisruptionDatapoints(pod)
+
 	return dps, dimProps
 }
 
+// recordPodDisruptionDatapoints folds a newly-seen Evicted pod or
+// OOMKilled container into the rolling per-node/per-namespace counters,
+// the same disruption signals the kubectl drain eviction workflow checks
+// for, and refreshes the aggregate counter datapoints in dpCache. Pods
+// are only counted once (by UID/container) since HandleAdd re-fires on
+// every resync of a pod that's already terminal.
+func (dc *DatapointCache) recordPodDisruptionDatapoints(pod *v1.Pod) {
+	changed := false
+
+	if pod.Status.Reason == "Evicted" && !dc.evictedPods[pod.UID] {
+		dc.evictedPods[pod.UID] = true
+		dc.nodeEvictionCounts[pod.Spec.NodeName]++
+		dc.namespaceEvictionCounts[pod.Namespace]++
+		changed = true
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Terminated == nil || cs.State.Terminated.Reason != "OOMKilled" {
+			continue
+		}
+
+		containerKey := string(pod.UID) + "/" + cs.Name
+		if dc.oomKilledContainers[containerKey] {
+			continue
+		}
+
+		dc.oomKilledContainers[containerKey] = true
+		dc.nodeOOMKillCounts[pod.Spec.NodeName]++
+		dc.namespaceOOMKillCounts[pod.Namespace]++
+		changed = true
+	}
+
+	if !changed {
+		return
+	}
+
+	// Every shard's informer watches the whole cluster, so without this
+	// check every shard would accumulate and emit identical full-cluster
+	// counters under these synthetic keys. fnv-hashing the (fixed) key
+	// deterministically picks a single owning shard, the same as any
+	// other resource's UID.
+	if dc.owns(nodeDisruptionCacheKey) {
+		dc.dpCache[nodeDisruptionCacheKey] = datapointsForDisruptionCounts(
+			"kubernetes_node", dc.nodeEvictionCounts, dc.nodeOOMKillCounts)
+	}
+	if dc.owns(namespaceDisruptionCacheKey) {
+		dc.dpCache[namespaceDisruptionCacheKey] = datapointsForDisruptionCounts(
+			"kubernetes_namespace", dc.namespaceEvictionCounts, dc.namespaceOOMKillCounts)
+	}
+}
+
+// datapointsForDisruptionCounts renders the per-dimName eviction/OOM-kill
+// counters accumulated so far as cumulative counter datapoints.
+func datapointsForDisruptionCounts(dimName string, evictions, oomKills map[string]int64) []*datapoint.Datapoint {
+	dps := make([]*datapoint.Datapoint, 0, len(evictions)+len(oomKills))
+
+	for name, count := range evictions {
+		if name == "" {
+			continue
+		}
+		dps = append(dps, sfxclient.Cumulative("kubernetes.pod_evictions", map[string]string{dimName: name}, count))
+	}
+
+	for name, count := range oomKills {
+		if name == "" {
+			continue
+		}
+		dps = append(dps, sfxclient.Cumulative("kubernetes.container_oom_kills", map[string]string{dimName: name}, count))
+	}
+
+	return dps
+}
+
 func (dc *DatapointCache) handleDeletePod(key interface{}) {
 	cacheKey := key.(types.UID)
 	dc.podServiceCache.DeletePodFromCache(cacheKey)
+	dc.podCache.DeleteByKey(cacheKey)
+
+	if rootUID, exists := dc.podRootOwner[cacheKey]; exists {
+		delete(dc.pendingRootOwner[rootUID], cacheKey)
+		if len(dc.pendingRootOwner[rootUID]) == 0 {
+			delete(dc.pendingRootOwner, rootUID)
+		}
+		delete(dc.podRootOwner, cacheKey)
+	}
+}
+
+// setOwnerPropsForPod walks podUID's owner chain (see
+// k8sutil.OwnerCache.OwnerChain) and sets the deployment/replicaSet/
+// statefulSet/daemonSet/job/cronJob properties it resolves to directly on
+// props, in O(depth) rather than scanning every other cached resource.
+//
+// It also records where the chain currently bottoms out in
+// pendingRootOwner, keyed by the UID of that unresolved ancestor, so that
+// if it's added to the cache later on, backfillPendingPods can revisit
+// just this pod instead of rescanning the whole pod cache.
+func (dc *DatapointCache) setOwnerPropsForPod(podUID types.UID, props map[string]string) {
+	chain := dc.ownerCache.OwnerChain(dc.podCache.GetOwnerReferences(podUID))
+
+	for _, ref := range chain {
+		if prop, ok := ownerPropertyForKind[ref.Kind]; ok {
+			props[prop] = ref.Name
+		}
+	}
+
+	rootUID := podUID
+	if len(chain) > 0 {
+		rootUID = chain[len(chain)-1].UID
+	}
+
+	if oldRoot, exists := dc.podRootOwner[podUID]; exists && oldRoot != rootUID {
+		delete(dc.pendingRootOwner[oldRoot], podUID)
+		if len(dc.pendingRootOwner[oldRoot]) == 0 {
+			delete(dc.pendingRootOwner, oldRoot)
+		}
+	}
+
+	dc.podRootOwner[podUID] = rootUID
+	if dc.pendingRootOwner[rootUID] == nil {
+		dc.pendingRootOwner[rootUID] = make(map[types.UID]bool)
+	}
+	dc.pendingRootOwner[rootUID][podUID] = true
+}
+
+// backfillPendingPods is called after a workload resource (e.g. a
+// Deployment) is added to ownerCache, in case it's the ancestor that some
+// already-cached pods were waiting on. It recomputes owner properties for
+// just the pods pending on ownerUID, rather than rescanning every cached
+// pod.
+func (dc *DatapointCache) backfillPendingPods(ownerUID types.UID) {
+	for podUID := range dc.pendingRootOwner[ownerUID] {
+		if dimProps, exists := dc.dimPropCache[podUID]; exists {
+			dc.setOwnerPropsForPod(podUID, dimProps.Properties)
+		}
+	}
 }
 
-// handleAddService adds a service to the cache and adds the "service" property
-// to each matching pod that the service selector matches
+// handleAddService adds a service to the cache. The "service" property on
+// its matching pods is refreshed via OnServicePodsChanged, which SetService
+// triggers synchronously with exactly the pods whose match against this
+// service changed.
 func (dc *DatapointCache) handleAddService(svc *v1.Service) {
 	dc.podServiceCache.SetService(svc)
-	podUIDs := dc.podServiceCache.GetPodUIDsForService(svc)
-	dc.updateServicePropForPods(podUIDs)
 }
 
-// handleDeleteService removes a service from the cache. After removing
-// the service from the cache, we need to update the "orphaned" pods
-// that may now match another service, or no service.
+// handleDeleteService removes a service from the cache. The "service"
+// property on its previously-matched ("orphaned") pods is refreshed via
+// OnServicePodsChanged, which DeleteServiceFromCache triggers synchronously.
 func (dc *DatapointCache) handleDeleteService(key interface{}) {
 	cacheKey := key.(types.UID)
-	podUIDs := dc.podServiceCache.GetPodUIDsForServiceUID(cacheKey)
 	dc.podServiceCache.DeleteServiceFromCache(cacheKey)
-	dc.updateServicePropForPods(podUIDs)
+}
+
+// OnServicePodsChanged implements k8sutil.PodServiceEventHandler. It's
+// called synchronously from SetService/DeleteServiceFromCache with
+// exactly the pods whose matched-service set changed, so the "service"
+// property only needs refreshing for those pods rather than every pod
+// the service currently (or previously) matches.
+func (dc *DatapointCache) OnServicePodsChanged(svcUID types.UID, added, removed []types.UID) {
+	dc.updateServicePropForPods(append(added, removed...))
+}
+
+// OnPodServicesChanged implements k8sutil.PodServiceEventHandler. A pod's
+// own label changes are already picked up by handleAddPod recomputing its
+// "service" property fresh on every add/update; this covers it too so the
+// property stays correct if a pod's matches ever change without the pod
+// itself being re-added (e.g. a future SetPod caller that doesn't go
+// through handleAddPod).
+func (dc *DatapointCache) OnPodServicesChanged(podUID types.UID, added, removed []types.UID) {
+	dc.updateServicePropForPods([]types.UID{podUID})
 }
 
 // updateServicePropForPods takes a list of pod UIDs, gets the matching
-// service for the pod, and adds the service property to the pod if one exists
+// service for the pod, and adds the service property to the pod if one
+// exists. Pods not yet in dimPropCache are skipped: that happens when a
+// brand new pod's first SetPod call fires OnPodServicesChanged before
+// HandleAdd has stored its dimProps, in which case handleAddPod's own
+// lookup (on the dimProps object about to be stored) already covers it.
 func (dc *DatapointCache) updateServicePropForPods(podUIDs []types.UID) {
 
 	for _, podUID := range podUIDs {
+		dimProps, exists := dc.dimPropCache[podUID]
+		if !exists {
+			continue
+		}
+
 		service, err := dc.podServiceCache.GetServiceNameForPodUID(podUID)
-		log.WithFields(log.Fields{
-			"service": service,
-			"err":     err,
-			"pod":     podUID,
-		}).Info("Adding/Removing service property to pod")
+		// Before the initial pod and service lists have been fully
+		// processed, it's expected for a pod to not yet have a matching
+		// service, so don't log what would otherwise look like an error.
+		if err == nil || dc.podServiceCache.HasSynced() {
+			log.WithFields(log.Fields{
+				"service": service,
+				"err":     err,
+				"pod":     podUID,
+			}).Info("Adding/Removing service property to pod")
+		}
 		if err != nil {
-			delete(dc.dimPropCache[podUID].Properties, "service")
+			delete(dimProps.Properties, "service")
 		} else {
-			dc.dimPropCache[podUID].Properties["service"] = service
+			dimProps.Properties["service"] = service
 		}
 	}
 }
+
+// HasSynced returns true once the underlying pod:service cache has fully
+// processed its initial pod and service lists, mirroring the
+// cache.Informer HasSynced convention from client-go so callers can wait
+// out cold-start before relying on property enrichment.
+func (dc *DatapointCache) HasSynced() bool {
+	return dc.podServiceCache.HasSynced()
+}
+
+// Register plugs a ResourceHandler into the cluster monitor for gvk,
+// overriding any handler (built-in or previously registered) for it. This
+// is how third parties add CRDs (Argo Rollouts, KusionStack CollaSets,
+// cert-manager Certificates, ...) to the cluster monitor without forking
+// it.
+func (dc *DatapointCache) Register(gvk schema.GroupVersionKind, h ResourceHandler) {
+	dc.handlerRegistry.Register(gvk, h)
+}
@@ -0,0 +1,407 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/signalfx/golib/datapoint"
+	"github.com/signalfx/golib/sfxclient"
+	atypes "github.com/signalfx/signalfx-agent/internal/monitors/types"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ResourceHandler converts a single watched K8s object into the
+// datapoints/dim properties that should be cached for it, and reports the
+// Kind it was handled as (stored in uidKindCache so DeleteByKey and the
+// owner-chain bookkeeping know what they're removing/backfilling).
+//
+// Third parties can implement this to plug CRDs (Argo Rollouts,
+// KusionStack CollaSets, cert-manager Certificates, ...) into the cluster
+// monitor without forking it, the same way controller-runtime's cache
+// accepts arbitrary GVK-scoped informers.
+type ResourceHandler interface {
+	Handle(dc *DatapointCache, obj runtime.Object) (kind string, dps []*datapoint.Datapoint, dimProps *atypes.DimProperties, err error)
+}
+
+// ResourceHandlerFunc adapts a plain function to a ResourceHandler.
+type ResourceHandlerFunc func(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error)
+
+// Handle calls f.
+func (f ResourceHandlerFunc) Handle(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	return f(dc, obj)
+}
+
+// ResourceHandlerRegistry maps a GVK to the ResourceHandler that knows how
+// to turn objects of that kind into datapoints/dim properties. Register
+// can be called after Handle is already being invoked from informer
+// event handler goroutines (a third party registering a CRD handler at
+// runtime), so all access goes through mu.
+type ResourceHandlerRegistry struct {
+	mu       sync.RWMutex
+	handlers map[schema.GroupVersionKind]ResourceHandler
+}
+
+// NewResourceHandlerRegistry creates a registry pre-populated with
+// built-in handlers for the core types the cluster monitor has always
+// supported, plus apps/v1 Deployment/ReplicaSet/DaemonSet/StatefulSet so
+// new clusters aren't stuck on the deprecated extensions/v1beta1 API
+// group.
+func NewResourceHandlerRegistry() *ResourceHandlerRegistry {
+	r := &ResourceHandlerRegistry{handlers: make(map[schema.GroupVersionKind]ResourceHandler)}
+	registerBuiltinHandlers(r)
+	return r
+}
+
+// Register associates h with gvk, overwriting any handler (built-in or
+// otherwise) previously registered for it. This is how third parties plug
+// CRDs into the cluster monitor.
+func (r *ResourceHandlerRegistry) Register(gvk schema.GroupVersionKind, h ResourceHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers[gvk] = h
+}
+
+// Handle looks up the handler registered for obj's GVK and invokes it.
+// ok is false if no handler is registered for that GVK.
+func (r *ResourceHandlerRegistry) Handle(dc *DatapointCache, obj runtime.Object) (kind string, dps []*datapoint.Datapoint, dimProps *atypes.DimProperties, err error, ok bool) {
+	r.mu.RLock()
+	h, exists := r.handlers[gvkForObject(obj)]
+	r.mu.RUnlock()
+	if !exists {
+		return "", nil, nil, nil, false
+	}
+	kind, dps, dimProps, err = h.Handle(dc, obj)
+	return kind, dps, dimProps, err, true
+}
+
+// gvkForObject resolves obj's GroupVersionKind for registry lookups.
+// Built-in typed objects returned by client-go informers/listers
+// virtually never have TypeMeta populated, so the kinds the cluster
+// monitor has always known about are resolved explicitly here. CRDs are
+// normally consumed as unstructured.Unstructured, which does carry GVK,
+// so they fall through to obj.GetObjectKind().
+func gvkForObject(obj runtime.Object) schema.GroupVersionKind {
+	switch obj.(type) {
+	case *v1.Pod:
+		return v1.SchemeGroupVersion.WithKind("Pod")
+	case *v1.Namespace:
+		return v1.SchemeGroupVersion.WithKind("Namespace")
+	case *v1.ReplicationController:
+		return v1.SchemeGroupVersion.WithKind("ReplicationController")
+	case *v1.ResourceQuota:
+		return v1.SchemeGroupVersion.WithKind("ResourceQuota")
+	case *v1.Node:
+		return v1.SchemeGroupVersion.WithKind("Node")
+	case *v1.Service:
+		return v1.SchemeGroupVersion.WithKind("Service")
+	case *policyv1beta1.PodDisruptionBudget:
+		return policyv1beta1.SchemeGroupVersion.WithKind("PodDisruptionBudget")
+	case *v1beta1.Deployment:
+		return v1beta1.SchemeGroupVersion.WithKind("Deployment")
+	case *v1beta1.ReplicaSet:
+		return v1beta1.SchemeGroupVersion.WithKind("ReplicaSet")
+	case *v1beta1.DaemonSet:
+		return v1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	case *appsv1.Deployment:
+		return appsv1.SchemeGroupVersion.WithKind("Deployment")
+	case *appsv1.ReplicaSet:
+		return appsv1.SchemeGroupVersion.WithKind("ReplicaSet")
+	case *appsv1.DaemonSet:
+		return appsv1.SchemeGroupVersion.WithKind("DaemonSet")
+	case *appsv1.StatefulSet:
+		return appsv1.SchemeGroupVersion.WithKind("StatefulSet")
+	case *batchv1.Job:
+		return batchv1.SchemeGroupVersion.WithKind("Job")
+	case *batchv1beta1.CronJob:
+		return batchv1beta1.SchemeGroupVersion.WithKind("CronJob")
+	default:
+		return obj.GetObjectKind().GroupVersionKind()
+	}
+}
+
+func registerBuiltinHandlers(r *ResourceHandlerRegistry) {
+	r.Register(v1.SchemeGroupVersion.WithKind("Pod"), ResourceHandlerFunc(handlePod))
+	r.Register(v1.SchemeGroupVersion.WithKind("Namespace"), ResourceHandlerFunc(handleNamespace))
+	r.Register(v1.SchemeGroupVersion.WithKind("ReplicationController"), ResourceHandlerFunc(handleReplicationController))
+	r.Register(v1.SchemeGroupVersion.WithKind("ResourceQuota"), ResourceHandlerFunc(handleResourceQuota))
+	r.Register(v1.SchemeGroupVersion.WithKind("Node"), ResourceHandlerFunc(handleNode))
+	r.Register(v1.SchemeGroupVersion.WithKind("Service"), ResourceHandlerFunc(handleService))
+	r.Register(policyv1beta1.SchemeGroupVersion.WithKind("PodDisruptionBudget"), ResourceHandlerFunc(handlePDB))
+
+	r.Register(v1beta1.SchemeGroupVersion.WithKind("Deployment"), ResourceHandlerFunc(handleDeploymentV1beta1))
+	r.Register(v1beta1.SchemeGroupVersion.WithKind("ReplicaSet"), ResourceHandlerFunc(handleReplicaSetV1beta1))
+	r.Register(v1beta1.SchemeGroupVersion.WithKind("DaemonSet"), ResourceHandlerFunc(handleDaemonSetV1beta1))
+
+	r.Register(appsv1.SchemeGroupVersion.WithKind("Deployment"), ResourceHandlerFunc(handleDeploymentV1))
+	r.Register(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"), ResourceHandlerFunc(handleReplicaSetV1))
+	r.Register(appsv1.SchemeGroupVersion.WithKind("DaemonSet"), ResourceHandlerFunc(handleDaemonSetV1))
+	r.Register(appsv1.SchemeGroupVersion.WithKind("StatefulSet"), ResourceHandlerFunc(handleStatefulSetV1))
+
+	r.Register(batchv1.SchemeGroupVersion.WithKind("Job"), ResourceHandlerFunc(handleJob))
+	r.Register(batchv1beta1.SchemeGroupVersion.WithKind("CronJob"), ResourceHandlerFunc(handleCronJob))
+}
+
+func handlePod(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *v1.Pod, got %T", obj)
+	}
+	dps, dimProps := dc.handleAddPod(pod)
+	return "Pod", dps, dimProps, nil
+}
+
+func handleNamespace(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	ns, ok := obj.(*v1.Namespace)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *v1.Namespace, got %T", obj)
+	}
+	return "Namespace", datapointsForNamespace(ns), nil, nil
+}
+
+func handleReplicationController(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	rc, ok := obj.(*v1.ReplicationController)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *v1.ReplicationController, got %T", obj)
+	}
+	return "ReplicationController", datapointsForReplicationController(rc), nil, nil
+}
+
+func handleResourceQuota(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	rq, ok := obj.(*v1.ResourceQuota)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *v1.ResourceQuota, got %T", obj)
+	}
+	return "ResourceQuota", datapointsForResourceQuota(rq), nil, nil
+}
+
+func handleNode(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *v1.Node, got %T", obj)
+	}
+	return "Node", datapointsForNode(node, dc.useNodeName), dimPropsForNode(node, dc.useNodeName), nil
+}
+
+func handleService(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	svc, ok := obj.(*v1.Service)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *v1.Service, got %T", obj)
+	}
+	dc.handleAddService(svc)
+	return "Service", nil, nil, nil
+}
+
+func handlePDB(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	pdb, ok := obj.(*policyv1beta1.PodDisruptionBudget)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *policyv1beta1.PodDisruptionBudget, got %T", obj)
+	}
+	dps, dimProps := dc.handleAddPDB(pdb)
+	return "PodDisruptionBudget", dps, dimProps, nil
+}
+
+func handleDeploymentV1beta1(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	d, ok := obj.(*v1beta1.Deployment)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *v1beta1.Deployment, got %T", obj)
+	}
+	dc.ownerCache.SetOwner("Deployment", d.UID, d.OwnerReferences)
+	return "Deployment", datapointsForDeployment(d), dimPropsForDeployment(d), nil
+}
+
+func handleReplicaSetV1beta1(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	rs, ok := obj.(*v1beta1.ReplicaSet)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *v1beta1.ReplicaSet, got %T", obj)
+	}
+	dc.ownerCache.SetOwner("ReplicaSet", rs.UID, rs.OwnerReferences)
+	return "ReplicaSet", datapointsForReplicaSet(rs), dimPropsForReplicaSet(rs), nil
+}
+
+func handleDaemonSetV1beta1(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	ds, ok := obj.(*v1beta1.DaemonSet)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *v1beta1.DaemonSet, got %T", obj)
+	}
+	dc.ownerCache.SetOwner("DaemonSet", ds.UID, ds.OwnerReferences)
+	return "DaemonSet", datapointsForDaemonSet(ds), nil, nil
+}
+
+func handleDeploymentV1(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	d, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *appsv1.Deployment, got %T", obj)
+	}
+	dc.ownerCache.SetOwner("Deployment", d.UID, d.OwnerReferences)
+	return "Deployment", datapointsForDeploymentV1(d), dimPropsForDeploymentV1(d), nil
+}
+
+func handleReplicaSetV1(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	rs, ok := obj.(*appsv1.ReplicaSet)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *appsv1.ReplicaSet, got %T", obj)
+	}
+	dc.ownerCache.SetOwner("ReplicaSet", rs.UID, rs.OwnerReferences)
+	return "ReplicaSet", datapointsForReplicaSetV1(rs), dimPropsForReplicaSetV1(rs), nil
+}
+
+func handleDaemonSetV1(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	ds, ok := obj.(*appsv1.DaemonSet)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *appsv1.DaemonSet, got %T", obj)
+	}
+	dc.ownerCache.SetOwner("DaemonSet", ds.UID, ds.OwnerReferences)
+	return "DaemonSet", datapointsForDaemonSetV1(ds), nil, nil
+}
+
+func handleStatefulSetV1(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	ss, ok := obj.(*appsv1.StatefulSet)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *appsv1.StatefulSet, got %T", obj)
+	}
+	dc.ownerCache.SetOwner("StatefulSet", ss.UID, ss.OwnerReferences)
+	return "StatefulSet", datapointsForStatefulSetV1(ss), dimPropsForStatefulSetV1(ss), nil
+}
+
+func handleJob(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *batchv1.Job, got %T", obj)
+	}
+	dc.ownerCache.SetOwner("Job", job.UID, job.OwnerReferences)
+	return "Job", datapointsForJob(job), dimPropsForJob(job), nil
+}
+
+func handleCronJob(dc *DatapointCache, obj runtime.Object) (string, []*datapoint.Datapoint, *atypes.DimProperties, error) {
+	cj, ok := obj.(*batchv1beta1.CronJob)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("expected *batchv1beta1.CronJob, got %T", obj)
+	}
+	dc.ownerCache.SetOwner("CronJob", cj.UID, cj.OwnerReferences)
+	return "CronJob", datapointsForCronJob(cj), dimPropsForCronJob(cj), nil
+}
+
+// datapointsForDeploymentV1 mirrors datapointsForDeployment for the apps/v1
+// API group.
+func datapointsForDeploymentV1(d *appsv1.Deployment) []*datapoint.Datapoint {
+	dimensions := map[string]string{
+		"kubernetes_namespace": d.Namespace,
+		"kubernetes_name":      d.Name,
+		"kubernetes_uid":       string(d.UID),
+	}
+
+	dps := []*datapoint.Datapoint{
+		sfxclient.Gauge("kubernetes.deployment.available", dimensions, int64(d.Status.AvailableReplicas)),
+		sfxclient.Gauge("kubernetes.deployment.unavailable", dimensions, int64(d.Status.UnavailableReplicas)),
+		sfxclient.Gauge("kubernetes.deployment.ready", dimensions, int64(d.Status.ReadyReplicas)),
+	}
+	if d.Spec.Replicas != nil {
+		dps = append(dps, sfxclient.Gauge("kubernetes.deployment.desired", dimensions, int64(*d.Spec.Replicas)))
+	}
+	return dps
+}
+
+func dimPropsForDeploymentV1(d *appsv1.Deployment) *atypes.DimProperties {
+	return &atypes.DimProperties{
+		Dimension: atypes.Dimension{
+			Name:  "kubernetes_uid",
+			Value: string(d.UID),
+		},
+		Properties: map[string]string{
+			"name":      d.Name,
+			"namespace": d.Namespace,
+		},
+	}
+}
+
+// datapointsForReplicaSetV1 mirrors datapointsForReplicaSet for the
+// apps/v1 API group.
+func datapointsForReplicaSetV1(rs *appsv1.ReplicaSet) []*datapoint.Datapoint {
+	dimensions := map[string]string{
+		"kubernetes_namespace": rs.Namespace,
+		"kubernetes_name":      rs.Name,
+		"kubernetes_uid":       string(rs.UID),
+	}
+
+	dps := []*datapoint.Datapoint{
+		sfxclient.Gauge("kubernetes.replica_set.available", dimensions, int64(rs.Status.AvailableReplicas)),
+		sfxclient.Gauge("kubernetes.replica_set.ready", dimensions, int64(rs.Status.ReadyReplicas)),
+	}
+	if rs.Spec.Replicas != nil {
+		dps = append(dps, sfxclient.Gauge("kubernetes.replica_set.desired", dimensions, int64(*rs.Spec.Replicas)))
+	}
+	return dps
+}
+
+func dimPropsForReplicaSetV1(rs *appsv1.ReplicaSet) *atypes.DimProperties {
+	return &atypes.DimProperties{
+		Dimension: atypes.Dimension{
+			Name:  "kubernetes_uid",
+			Value: string(rs.UID),
+		},
+		Properties: map[string]string{
+			"name":      rs.Name,
+			"namespace": rs.Namespace,
+		},
+	}
+}
+
+// datapointsForDaemonSetV1 mirrors datapointsForDaemonSet for the apps/v1
+// API group.
+func datapointsForDaemonSetV1(ds *appsv1.DaemonSet) []*datapoint.Datapoint {
+	dimensions := map[string]string{
+		"kubernetes_namespace": ds.Namespace,
+		"kubernetes_name":      ds.Name,
+		"kubernetes_uid":       string(ds.UID),
+	}
+
+	return []*datapoint.Datapoint{
+		sfxclient.Gauge("kubernetes.daemon_set.current_scheduled", dimensions, int64(ds.Status.CurrentNumberScheduled)),
+		sfxclient.Gauge("kubernetes.daemon_set.desired_scheduled", dimensions, int64(ds.Status.DesiredNumberScheduled)),
+		sfxclient.Gauge("kubernetes.daemon_set.misscheduled", dimensions, int64(ds.Status.NumberMisscheduled)),
+		sfxclient.Gauge("kubernetes.daemon_set.ready", dimensions, int64(ds.Status.NumberReady)),
+	}
+}
+
+// datapointsForStatefulSetV1 and dimPropsForStatefulSetV1 give the
+// apps/v1 StatefulSet the same replica-count visibility as Deployment,
+// closing the gap where StatefulSet-based workloads (databases, queues)
+// otherwise show up only as raw pods with no aggregate.
+func datapointsForStatefulSetV1(ss *appsv1.StatefulSet) []*datapoint.Datapoint {
+	dimensions := map[string]string{
+		"kubernetes_namespace": ss.Namespace,
+		"kubernetes_name":      ss.Name,
+		"kubernetes_uid":       string(ss.UID),
+	}
+
+	dps := []*datapoint.Datapoint{
+		sfxclient.Gauge("kubernetes.stateful_set.ready_replicas", dimensions, int64(ss.Status.ReadyReplicas)),
+		sfxclient.Gauge("kubernetes.stateful_set.current_replicas", dimensions, int64(ss.Status.CurrentReplicas)),
+		sfxclient.Gauge("kubernetes.stateful_set.updated_replicas", dimensions, int64(ss.Status.UpdatedReplicas)),
+	}
+	if ss.Spec.Replicas != nil {
+		dps = append(dps, sfxclient.Gauge("kubernetes.stateful_set.replicas", dimensions, int64(*ss.Spec.Replicas)))
+	}
+	return dps
+}
+
+func dimPropsForStatefulSetV1(ss *appsv1.StatefulSet) *atypes.DimProperties {
+	return &atypes.DimProperties{
+		Dimension: atypes.Dimension{
+			Name:  "kubernetes_uid",
+			Value: string(ss.UID),
+		},
+		Properties: map[string]string{
+			"name":      ss.Name,
+			"namespace": ss.Namespace,
+		},
+	}
+}
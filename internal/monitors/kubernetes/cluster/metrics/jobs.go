@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"github.com/signalfx/golib/datapoint"
+	"github.com/signalfx/golib/sfxclient"
+	atypes "github.com/signalfx/signalfx-agent/internal/monitors/types"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// datapointsForJob returns datapoints describing a Job's progress toward
+// completion, the same active/succeeded/failed pod counts kubectl reports
+// in `kubectl describe job`.
+func datapointsForJob(job *batchv1.Job) []*datapoint.Datapoint {
+	dimensions := map[string]string{
+		"kubernetes_namespace": job.Namespace,
+		"kubernetes_name":      job.Name,
+		"kubernetes_uid":       string(job.UID),
+	}
+
+	dps := []*datapoint.Datapoint{
+		sfxclient.Gauge("kubernetes.job.active", dimensions, int64(job.Status.Active)),
+		sfxclient.Gauge("kubernetes.job.succeeded", dimensions, int64(job.Status.Succeeded)),
+		sfxclient.Gauge("kubernetes.job.failed", dimensions, int64(job.Status.Failed)),
+	}
+
+	if job.Status.CompletionTime != nil {
+		dps = append(dps, sfxclient.Gauge("kubernetes.job.completed", dimensions, 1))
+	} else {
+		dps = append(dps, sfxclient.Gauge("kubernetes.job.completed", dimensions, 0))
+	}
+
+	return dps
+}
+
+// dimPropsForJob links a Job to the CronJob that created it, if any, the
+// same way dimPropsForPod surfaces its controlling Deployment/ReplicaSet.
+func dimPropsForJob(job *batchv1.Job) *atypes.DimProperties {
+	props := map[string]string{
+		"name":      job.Name,
+		"namespace": job.Namespace,
+	}
+
+	if ref, ok := controllerRefOf(job.OwnerReferences); ok && ref.Kind == "CronJob" {
+		props["cronJob"] = ref.Name
+	}
+
+	return &atypes.DimProperties{
+		Dimension: atypes.Dimension{
+			Name:  "kubernetes_uid",
+			Value: string(job.UID),
+		},
+		Properties: props,
+	}
+}
+
+// datapointsForCronJob returns datapoints describing a CronJob's schedule
+// state: how many Jobs it currently has running, whether it's suspended,
+// and when it last fired -- the last_schedule_time gauge is what lets an
+// operator tell "this schedule stopped firing" apart from "it's just
+// idle between runs", which active/suspended alone can't.
+func datapointsForCronJob(cj *batchv1beta1.CronJob) []*datapoint.Datapoint {
+	dimensions := map[string]string{
+		"kubernetes_namespace": cj.Namespace,
+		"kubernetes_name":      cj.Name,
+		"kubernetes_uid":       string(cj.UID),
+	}
+
+	suspended := int64(0)
+	if cj.Spec.Suspend != nil && *cj.Spec.Suspend {
+		suspended = 1
+	}
+
+	dps := []*datapoint.Datapoint{
+		sfxclient.Gauge("kubernetes.cron_job.active", dimensions, int64(len(cj.Status.Active))),
+		sfxclient.Gauge("kubernetes.cron_job.suspended", dimensions, suspended),
+	}
+
+	if cj.Status.LastScheduleTime != nil {
+		dps = append(dps, sfxclient.Gauge("kubernetes.cron_job.last_schedule_time", dimensions, cj.Status.LastScheduleTime.Unix()))
+	}
+
+	return dps
+}
+
+// dimPropsForCronJob gives a CronJob the same name/namespace dim
+// properties as every other workload kind.
+func dimPropsForCronJob(cj *batchv1beta1.CronJob) *atypes.DimProperties {
+	return &atypes.DimProperties{
+		Dimension: atypes.Dimension{
+			Name:  "kubernetes_uid",
+			Value: string(cj.UID),
+		},
+		Properties: map[string]string{
+			"name":      cj.Name,
+			"namespace": cj.Namespace,
+		},
+	}
+}
+
+// controllerRefOf returns the owner reference in refs that is the
+// controlling owner (Controller == true), if any. This mirrors the
+// unexported controllerRef helper in k8sutil.OwnerCache, which isn't
+// reachable from this package.
+func controllerRefOf(refs []metav1.OwnerReference) (metav1.OwnerReference, bool) {
+	for _, ref := range refs {
+		if ref.Controller != nil && *ref.Controller {
+			return ref, true
+		}
+	}
+	return metav1.OwnerReference{}, false
+}
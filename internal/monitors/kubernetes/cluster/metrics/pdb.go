@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"github.com/signalfx/golib/datapoint"
+	"github.com/signalfx/golib/sfxclient"
+	atypes "github.com/signalfx/signalfx-agent/internal/monitors/types"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// datapointsForPDB returns datapoints describing a PodDisruptionBudget's
+// current disruption allowance, the same status fields the kubectl drain
+// eviction workflow checks before evicting a pod, so users can alert on
+// nodes with saturated disruption budgets during rolling upgrades.
+func datapointsForPDB(pdb *policyv1beta1.PodDisruptionBudget) []*datapoint.Datapoint {
+	dimensions := map[string]string{
+		"kubernetes_namespace": pdb.Namespace,
+		"kubernetes_pdb_name":  pdb.Name,
+		"kubernetes_pdb_uid":   string(pdb.UID),
+	}
+
+	return []*datapoint.Datapoint{
+		sfxclient.Gauge("kubernetes.pdb.disruptions_allowed", dimensions, int64(pdb.Status.DisruptionsAllowed)),
+		sfxclient.Gauge("kubernetes.pdb.current_healthy", dimensions, int64(pdb.Status.CurrentHealthy)),
+		sfxclient.Gauge("kubernetes.pdb.desired_healthy", dimensions, int64(pdb.Status.DesiredHealthy)),
+		sfxclient.Gauge("kubernetes.pdb.expected_pods", dimensions, int64(pdb.Status.ExpectedPods)),
+	}
+}
+
+// dimPropsForPDB gives a PodDisruptionBudget the same name/namespace dim
+// properties as every other workload kind. Linking it to its selected
+// pods (the "podDisruptionBudget" property on each matching pod) happens
+// separately in updatePDBPropForPods, the same way a Service's selector
+// is surfaced as the "service" property on its matching pods.
+func dimPropsForPDB(pdb *policyv1beta1.PodDisruptionBudget) *atypes.DimProperties {
+	return &atypes.DimProperties{
+		Dimension: atypes.Dimension{
+			Name:  "kubernetes_pdb_uid",
+			Value: string(pdb.UID),
+		},
+		Properties: map[string]string{
+			"name":      pdb.Name,
+			"namespace": pdb.Namespace,
+		},
+	}
+}
+
+// handleAddPDB returns the datapoints/dim properties for pdb, and adds
+// the "podDisruptionBudget" property to every currently cached pod in its
+// namespace that pdb.Spec.Selector matches.
+func (dc *DatapointCache) handleAddPDB(pdb *policyv1beta1.PodDisruptionBudget) ([]*datapoint.Datapoint, *atypes.DimProperties) {
+	dc.updatePDBPropForPods(pdb)
+	return datapointsForPDB(pdb), dimPropsForPDB(pdb)
+}
+
+// updatePDBPropForPods adds the "podDisruptionBudget" property to every
+// currently cached pod in pdb's namespace that pdb.Spec.Selector matches,
+// the same way updateServicePropForPods surfaces a Service's selector as
+// the "service" property on its matching pods.
+func (dc *DatapointCache) updatePDBPropForPods(pdb *policyv1beta1.PodDisruptionBudget) {
+	selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+	if err != nil || selector.Empty() {
+		return
+	}
+
+	for _, podUID := range dc.podCache.GetPodsInNamespace(pdb.Namespace) {
+		dimProps, exists := dc.dimPropCache[podUID]
+		if !exists || !selector.Matches(dc.podCache.GetLabels(podUID)) {
+			continue
+		}
+		dimProps.Properties["podDisruptionBudget"] = pdb.Name
+	}
+}
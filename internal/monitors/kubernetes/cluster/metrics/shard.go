@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ShardConfig splits the cluster's resources across Total cooperating
+// agent instances by consistent-hashing each resource's UID, so that a
+// cluster whose informer event rate or DimProperties sync throughput
+// outgrows a single agent process can be scaled horizontally by running
+// Total instances side by side, each configured with a distinct Index.
+//
+// Nothing in this tree currently assigns a non-zero-value ShardConfig to a
+// DatapointCache -- there is no monitor-level Configure/startup path in
+// this snapshot to plumb a shard index (auto-negotiated or explicit)
+// through to it. owns() is left in place as the gating primitive a future
+// Configure path can drive once that wiring exists; until then every
+// instance owns every resource, identical to pre-sharding behavior.
+type ShardConfig struct {
+	// Total is the number of cooperating shards. Total <= 1 disables
+	// sharding: every instance owns every resource, matching the
+	// behavior before ShardConfig existed.
+	Total int
+	// Index is this instance's shard number, in [0, Total).
+	Index int
+}
+
+// valid reports whether cfg describes an active, well-formed sharding
+// assignment.
+func (cfg ShardConfig) valid() bool {
+	return cfg.Total > 1 && cfg.Index >= 0 && cfg.Index < cfg.Total
+}
+
+// owns reports whether uid hashes to this instance's shard. Owner-chain
+// bookkeeping (ownerCache, podCache, uidKindCache) stays cluster-wide
+// across all shards regardless of ownership, since it's cheap and other
+// shards' pods may depend on it to resolve their ancestry; only the
+// expensive datapoint/dim-property payload is restricted to what this
+// shard owns.
+func (dc *DatapointCache) owns(uid types.UID) bool {
+	if !dc.shardConfig.valid() {
+		return true
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(uid))
+	return int(h.Sum32()%uint32(dc.shardConfig.Total)) == dc.shardConfig.Index
+}
@@ -0,0 +1,209 @@
+package metrics
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/signalfx/golib/datapoint"
+	atypes "github.com/signalfx/signalfx-agent/internal/monitors/types"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// snapshotSchemaVersion is bumped whenever the on-disk snapshot layout
+// changes in a way an older agent version couldn't read back correctly,
+// so Restore can reject a snapshot it doesn't understand instead of
+// corrupting the live cache.
+const snapshotSchemaVersion = 1
+
+// snapshotDatapoint is a gob-friendly mirror of datapoint.Datapoint --
+// Value is an interface (IntValue/FloatValue) that isn't directly
+// gob-encodable, so it's flattened to whichever of IntVal/FloatVal the
+// original held.
+type snapshotDatapoint struct {
+	Metric     string
+	Dimensions map[string]string
+	MetricType datapoint.MetricType
+	Timestamp  time.Time
+	IsFloat    bool
+	IntVal     int64
+	FloatVal   float64
+}
+
+type snapshotDimProps struct {
+	Dimension  atypes.Dimension
+	Properties map[string]string
+	Tags       map[string]bool
+}
+
+// snapshot is the full on-disk representation written by Snapshot and
+// read back by Restore.
+//
+// podServiceCache isn't included: it's a pure index derived from Pod and
+// Service objects, so it rebuilds for free as the informer resync that's
+// already running on restart delivers them. What's expensive to
+// reconstruct -- and what actually causes the cold-start metric gap on
+// large clusters -- is dpCache/dimPropCache/uidKindCache, so that's what
+// gets persisted.
+type snapshot struct {
+	SchemaVersion int
+	CreatedAt     time.Time
+	DpCache       map[types.UID][]snapshotDatapoint
+	DimPropCache  map[types.UID]snapshotDimProps
+	UIDKindCache  map[types.UID]string
+}
+
+// Snapshot serializes the cache's datapoints, dim properties, and kind
+// index to w, so a restart can warm-start from Restore instead of paying
+// the multi-minute cold-start gap while informers re-sync thousands of
+// pods.
+func (dc *DatapointCache) Snapshot(w io.Writer) error {
+	dc.Lock()
+	defer dc.Unlock()
+
+	snap := snapshot{
+		SchemaVersion: snapshotSchemaVersion,
+		CreatedAt:     time.Now(),
+		DpCache:       make(map[types.UID][]snapshotDatapoint, len(dc.dpCache)),
+		DimPropCache:  make(map[types.UID]snapshotDimProps, len(dc.dimPropCache)),
+		UIDKindCache:  make(map[types.UID]string, len(dc.uidKindCache)),
+	}
+
+	for uid, dps := range dc.dpCache {
+		sdps := make([]snapshotDatapoint, 0, len(dps))
+		for _, dp := range dps {
+			sdp, err := toSnapshotDatapoint(dp)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":  err,
+					"metric": dp.Metric,
+				}).Warn("Skipping datapoint that can't be snapshotted")
+				continue
+			}
+			sdps = append(sdps, sdp)
+		}
+		snap.DpCache[uid] = sdps
+	}
+
+	for uid, dimProps := range dc.dimPropCache {
+		snap.DimPropCache[uid] = snapshotDimProps{
+			Dimension:  dimProps.Dimension,
+			Properties: dimProps.Properties,
+			Tags:       dimProps.Tags,
+		}
+	}
+
+	for uid, kind := range dc.uidKindCache {
+		snap.UIDKindCache[uid] = kind
+	}
+
+	return gob.NewEncoder(w).Encode(&snap)
+}
+
+// Restore reloads a cache previously written by Snapshot, discarding it
+// if it's older than maxAge -- a stale snapshot is worse than an empty
+// cache, since it would re-emit properties for resources that no longer
+// exist. Restored entries are provisional until PruneUnconfirmedRestored
+// is called once the informers have finished their first sync: any
+// restored UID that HandleAdd hasn't re-confirmed by then is dropped,
+// since it means that resource was deleted while the agent was down.
+func (dc *DatapointCache) Restore(r io.Reader, maxAge time.Duration) error {
+	var snap snapshot
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("decoding cache snapshot: %w", err)
+	}
+
+	if snap.SchemaVersion != snapshotSchemaVersion {
+		return fmt.Errorf("cache snapshot schema version %d is not the %d this agent understands",
+			snap.SchemaVersion, snapshotSchemaVersion)
+	}
+
+	if age := time.Since(snap.CreatedAt); age > maxAge {
+		return fmt.Errorf("cache snapshot is %s old, older than the %s TTL -- discarding", age, maxAge)
+	}
+
+	dc.Lock()
+	defer dc.Unlock()
+
+	dc.restoredUIDs = make(map[types.UID]bool, len(snap.UIDKindCache))
+
+	for uid, sdps := range snap.DpCache {
+		dps := make([]*datapoint.Datapoint, 0, len(sdps))
+		for _, sdp := range sdps {
+			dps = append(dps, fromSnapshotDatapoint(sdp))
+		}
+		dc.dpCache[uid] = dps
+	}
+
+	for uid, sdp := range snap.DimPropCache {
+		dc.dimPropCache[uid] = &atypes.DimProperties{
+			Dimension:  sdp.Dimension,
+			Properties: sdp.Properties,
+			Tags:       sdp.Tags,
+		}
+	}
+
+	for uid, kind := range snap.UIDKindCache {
+		dc.uidKindCache[uid] = kind
+		dc.restoredUIDs[uid] = true
+	}
+
+	return nil
+}
+
+// PruneUnconfirmedRestored removes cache entries left over from a prior
+// Restore whose UID hasn't been re-confirmed by a HandleAdd call since.
+// Call this once the backing informers report HasSynced, so placeholder
+// data restored for a resource that was actually deleted while the agent
+// was down doesn't linger and get re-emitted forever.
+func (dc *DatapointCache) PruneUnconfirmedRestored() {
+	dc.Lock()
+	defer dc.Unlock()
+
+	for uid := range dc.restoredUIDs {
+		delete(dc.dpCache, uid)
+		delete(dc.dimPropCache, uid)
+		delete(dc.uidKindCache, uid)
+	}
+	dc.restoredUIDs = nil
+}
+
+func toSnapshotDatapoint(dp *datapoint.Datapoint) (snapshotDatapoint, error) {
+	sdp := snapshotDatapoint{
+		Metric:     dp.Metric,
+		Dimensions: dp.Dimensions,
+		MetricType: dp.MetricType,
+		Timestamp:  dp.Timestamp,
+	}
+
+	switch v := dp.Value.(type) {
+	case datapoint.IntValue:
+		sdp.IntVal = v.Int()
+	case datapoint.FloatValue:
+		sdp.IsFloat = true
+		sdp.FloatVal = v.Float()
+	default:
+		return snapshotDatapoint{}, fmt.Errorf("unsupported datapoint value type %T for metric %s", dp.Value, dp.Metric)
+	}
+
+	return sdp, nil
+}
+
+func fromSnapshotDatapoint(sdp snapshotDatapoint) *datapoint.Datapoint {
+	var value datapoint.Value
+	if sdp.IsFloat {
+		value = datapoint.NewFloatValue(sdp.FloatVal)
+	} else {
+		value = datapoint.NewIntValue(sdp.IntVal)
+	}
+
+	return &datapoint.Datapoint{
+		Metric:     sdp.Metric,
+		Dimensions: sdp.Dimensions,
+		MetricType: sdp.MetricType,
+		Value:      value,
+		Timestamp:  sdp.Timestamp,
+	}
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maxOwnerChainHops bounds how far GetRootOwner will walk up an owner
+// chain, as a cheap guard against cycles in malformed/adversarial owner
+// reference graphs.
+const maxOwnerChainHops = 10
+
+// OwnerCache holds the owner references of workload resources
+// (ReplicaSet, Job, StatefulSet, DaemonSet, Deployment, CronJob, ...) so
+// that PodCache.GetRootOwner can walk from a pod's immediate parent (often
+// a ReplicaSet) up to the top-level workload it belongs to (e.g. a
+// Deployment), the same way Kubernetes controllers resolve ownership.
+type OwnerCache struct {
+	mu sync.RWMutex
+
+	ownerUIDKindCache map[types.UID]string
+	ownerUIDRefCache  map[types.UID][]metav1.OwnerReference
+}
+
+// NewOwnerCache creates a new empty OwnerCache
+func NewOwnerCache() *OwnerCache {
+	return &OwnerCache{
+		ownerUIDKindCache: make(map[types.UID]string),
+		ownerUIDRefCache:  make(map[types.UID][]metav1.OwnerReference),
+	}
+}
+
+// SetOwner adds or updates a workload resource's owner references in the
+// cache, keyed by its own UID, so it can be found while walking up a pod's
+// owner chain.
+func (oc *OwnerCache) SetOwner(kind string, uid types.UID, ownerReferences []metav1.OwnerReference) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	oc.ownerUIDKindCache[uid] = kind
+	oc.ownerUIDRefCache[uid] = ownerReferences
+}
+
+// DeleteByKey removes a workload resource from the cache given its UID.
+func (oc *OwnerCache) DeleteByKey(uid types.UID) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	delete(oc.ownerUIDKindCache, uid)
+	delete(oc.ownerUIDRefCache, uid)
+}
+
+// controllerRef returns the owner reference in refs that is the
+// controlling owner (Controller == true), if any.
+func controllerRef(refs []metav1.OwnerReference) (metav1.OwnerReference, bool) {
+	for _, ref := range refs {
+		if ref.Controller != nil && *ref.Controller {
+			return ref, true
+		}
+	}
+	return metav1.OwnerReference{}, false
+}
+
+// KindOf returns the kind a resource was registered under via SetOwner.
+func (oc *OwnerCache) KindOf(uid types.UID) (string, bool) {
+	oc.mu.RLock()
+	defer oc.mu.RUnlock()
+
+	kind, ok := oc.ownerUIDKindCache[uid]
+	return kind, ok
+}
+
+// OwnerChain follows the chain of controlling owner references starting
+// at refs (typically a pod's cached owner references, see
+// PodCache.GetOwnerReferences) up through oc, and returns it as an
+// ordered list from the immediate parent to the top-level workload
+// (Deployment, StatefulSet, DaemonSet, Job/CronJob, or whatever resource
+// has no further known or controlling owner). Returns nil if refs has no
+// controlling owner at all (e.g. a naked pod).
+//
+// The walk is capped at maxOwnerChainHops to guard against cycles, and an
+// owner that isn't present in oc (not added yet, or deleted out-of-order)
+// ends the walk rather than erroring: its reference, taken from its
+// child, is still the last entry of the chain, but nothing above it is
+// followed.
+func (oc *OwnerCache) OwnerChain(refs []metav1.OwnerReference) []metav1.OwnerReference {
+	ref, found := controllerRef(refs)
+	if !found {
+		return nil
+	}
+
+	chain := []metav1.OwnerReference{ref}
+	visited := map[types.UID]bool{ref.UID: true}
+
+	for hop := 0; hop < maxOwnerChainHops; hop++ {
+		oc.mu.RLock()
+		parentRefs, exists := oc.ownerUIDRefCache[ref.UID]
+		oc.mu.RUnlock()
+
+		if !exists {
+			break
+		}
+
+		parentRef, found := controllerRef(parentRefs)
+		if !found || visited[parentRef.UID] {
+			break
+		}
+
+		chain = append(chain, parentRef)
+		visited[parentRef.UID] = true
+		ref = parentRef
+	}
+
+	return chain
+}
+
+// GetRootOwner follows the chain of controller owner references starting
+// at podUID's cached owner references up through oc (see OwnerChain) and
+// returns the top-level workload it resolves to. An ancestor above the
+// pod's immediate parent that isn't present in oc (e.g. a Deployment
+// deleted before its ReplicaSet) is not reported; the last owner that is
+// in oc is returned instead. Returns ok=false if the pod has no
+// controlling owner at all (a naked pod).
+func (pc *PodCache) GetRootOwner(podUID types.UID, oc *OwnerCache) (kind string, name string, uid types.UID, ok bool) {
+	chain := oc.OwnerChain(pc.GetOwnerReferences(podUID))
+	if len(chain) == 0 {
+		return "", "", "", false
+	}
+
+	root := chain[len(chain)-1]
+	if len(chain) > 1 {
+		if _, cached := oc.KindOf(root.UID); !cached {
+			root = chain[len(chain)-2]
+		}
+	}
+	return root.Kind, root.Name, root.UID, true
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func controllerOwnerRef(kind, name string, uid types.UID) metav1.OwnerReference {
+	t := true
+	return metav1.OwnerReference{
+		Kind:       kind,
+		Name:       name,
+		UID:        uid,
+		Controller: &t,
+	}
+}
+
+func podWithOwner(uid types.UID, owner *metav1.OwnerReference) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:       uid,
+			Namespace: "default",
+		},
+	}
+	if owner != nil {
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return pod
+}
+
+// TestOwnerChainNakedPod covers a pod with no controlling owner reference
+// at all -- OwnerChain must return nil rather than panicking or fabricating
+// a chain.
+func TestOwnerChainNakedPod(t *testing.T) {
+	pc := NewPodCache()
+	oc := NewOwnerCache()
+
+	pod := podWithOwner("pod-naked", nil)
+	pc.AddPod(pod)
+
+	chain := oc.OwnerChain(pc.GetOwnerReferences(pod.UID))
+	if chain != nil {
+		t.Fatalf("expected nil chain for a naked pod, got %v", chain)
+	}
+
+	kind, name, uid, ok := pc.GetRootOwner(pod.UID, oc)
+	if ok {
+		t.Fatalf("expected ok=false for a naked pod, got kind=%s name=%s uid=%s", kind, name, uid)
+	}
+}
+
+// TestOwnerChainJobOwnedPod covers a pod owned directly by a Job (no
+// further parent, as Jobs aren't themselves typically owned by anything
+// else unless spawned by a CronJob).
+func TestOwnerChainJobOwnedPod(t *testing.T) {
+	pc := NewPodCache()
+	oc := NewOwnerCache()
+
+	jobRef := controllerOwnerRef("Job", "my-job", "job-uid")
+	pod := podWithOwner("pod-job", &jobRef)
+	pc.AddPod(pod)
+	oc.SetOwner("Job", "job-uid", nil)
+
+	kind, name, uid, ok := pc.GetRootOwner(pod.UID, oc)
+	if !ok {
+		t.Fatal("expected ok=true for a Job-owned pod")
+	}
+	if kind != "Job" || name != "my-job" || uid != "job-uid" {
+		t.Errorf("got kind=%s name=%s uid=%s, want Job/my-job/job-uid", kind, name, uid)
+	}
+}
+
+// TestOwnerChainReplicaSetDeploymentOutOfOrderDelete covers the common
+// Deployment -> ReplicaSet -> Pod chain, and the out-of-order-delete case
+// where the Deployment is removed from the cache before the pod (e.g. its
+// delete event is processed first): GetRootOwner should then report the
+// ReplicaSet, the last owner still in the cache, rather than erroring.
+func TestOwnerChainReplicaSetDeploymentOutOfOrderDelete(t *testing.T) {
+	pc := NewPodCache()
+	oc := NewOwnerCache()
+
+	deployRef := controllerOwnerRef("Deployment", "my-deploy", "deploy-uid")
+	rsRef := controllerOwnerRef("ReplicaSet", "my-rs", "rs-uid")
+	pod := podWithOwner("pod-rs", &rsRef)
+	pc.AddPod(pod)
+	oc.SetOwner("ReplicaSet", "rs-uid", []metav1.OwnerReference{deployRef})
+	oc.SetOwner("Deployment", "deploy-uid", nil)
+
+	kind, name, uid, ok := pc.GetRootOwner(pod.UID, oc)
+	if !ok {
+		t.Fatal("expected ok=true for a ReplicaSet/Deployment-owned pod")
+	}
+	if kind != "Deployment" || name != "my-deploy" || uid != "deploy-uid" {
+		t.Errorf("got kind=%s name=%s uid=%s, want Deployment/my-deploy/deploy-uid", kind, name, uid)
+	}
+
+	// The Deployment is deleted (e.g. its delete event races ahead of the
+	// pod's), leaving the ReplicaSet as an orphaned intermediate owner.
+	oc.DeleteByKey("deploy-uid")
+
+	kind, name, uid, ok = pc.GetRootOwner(pod.UID, oc)
+	if !ok {
+		t.Fatal("expected ok=true even after the Deployment parent is deleted out of order")
+	}
+	if kind != "ReplicaSet" || name != "my-rs" || uid != "rs-uid" {
+		t.Errorf("got kind=%s name=%s uid=%s, want the chain to end at ReplicaSet/my-rs/rs-uid", kind, name, uid)
+	}
+}
+
+// TestOwnerChainCycleDetection covers a malformed owner reference graph
+// with a cycle: OwnerChain must stop instead of looping forever, both via
+// the visited-set check and the maxOwnerChainHops hop cap.
+func TestOwnerChainCycleDetection(t *testing.T) {
+	pc := NewPodCache()
+	oc := NewOwnerCache()
+
+	aRef := controllerOwnerRef("ReplicaSet", "a", "uid-a")
+	bRef := controllerOwnerRef("ReplicaSet", "b", "uid-b")
+	pod := podWithOwner("pod-cycle", &aRef)
+	pc.AddPod(pod)
+
+	// a -> b -> a, a direct cycle.
+	oc.SetOwner("ReplicaSet", "uid-a", []metav1.OwnerReference{bRef})
+	oc.SetOwner("ReplicaSet", "uid-b", []metav1.OwnerReference{aRef})
+
+	chain := oc.OwnerChain(pc.GetOwnerReferences(pod.UID))
+	if len(chain) != 2 {
+		t.Fatalf("expected the cycle to be broken after 2 distinct owners, got %d: %v", len(chain), chain)
+	}
+	if chain[0].UID != "uid-a" || chain[1].UID != "uid-b" {
+		t.Errorf("got chain %v, want [uid-a, uid-b]", chain)
+	}
+}
+
+// TestOwnerChainHopCap covers a long (but acyclic) owner chain exceeding
+// maxOwnerChainHops: OwnerChain must stop at the cap rather than walking
+// indefinitely.
+func TestOwnerChainHopCap(t *testing.T) {
+	pc := NewPodCache()
+	oc := NewOwnerCache()
+
+	const depth = maxOwnerChainHops + 5
+
+	rootRef := controllerOwnerRef("ReplicaSet", "owner-0", types.UID("uid-0"))
+	pod := podWithOwner("pod-deep", &rootRef)
+	pc.AddPod(pod)
+
+	for i := 0; i < depth; i++ {
+		uid := types.UID(fmt.Sprintf("uid-%d", i))
+		parentUID := types.UID(fmt.Sprintf("uid-%d", i+1))
+		parentRef := controllerOwnerRef("ReplicaSet", fmt.Sprintf("owner-%d", i+1), parentUID)
+		oc.SetOwner("ReplicaSet", uid, []metav1.OwnerReference{parentRef})
+	}
+
+	chain := oc.OwnerChain(pc.GetOwnerReferences(pod.UID))
+	if len(chain) != maxOwnerChainHops+1 {
+		t.Fatalf("expected the walk to stop at maxOwnerChainHops+1 entries, got %d", len(chain))
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"reflect"
+	"sync"
 
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -12,8 +13,12 @@ import (
 type podsSet map[types.UID]bool
 
 // PodCache is used for holding values we care about from a pod
-// for quicker lookup than querying the API for them each time.
+// for quicker lookup than querying the API for them each time. It is
+// accessed concurrently from informer event handler goroutines and from
+// datapoint-enrichment goroutines, so all access goes through mu.
 type PodCache struct {
+	mu sync.RWMutex
+
 	namespacePodUIDCache map[string]podsSet
 	podUIDNamespaceCache map[types.UID]string
 	podUIDLabelCache     map[types.UID]labels.Set
@@ -33,6 +38,9 @@ func NewPodCache() *PodCache {
 // IsCached checks if a pod was already in the cache, or if
 // the mapped values have changed. Returns true if no change
 func (pc *PodCache) IsCached(pod *v1.Pod) bool {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
 	labelSet := labels.Set(pod.Labels)
 	cachedLabelSet := pc.podUIDLabelCache[pod.UID]
 	cachedNamespace := pc.podUIDNamespaceCache[pod.UID]
@@ -45,6 +53,9 @@ func (pc *PodCache) IsCached(pod *v1.Pod) bool {
 
 // AddPod adds or updates a pod in cache
 func (pc *PodCache) AddPod(pod *v1.Pod) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
 	if _, exists := pc.namespacePodUIDCache[pod.Namespace]; !exists {
 		pc.namespacePodUIDCache[pod.Namespace] = make(map[types.UID]bool)
 	}
@@ -56,6 +67,9 @@ func (pc *PodCache) AddPod(pod *v1.Pod) {
 
 // DeleteByKey removes a pod from the cache given a UID
 func (pc *PodCache) DeleteByKey(key types.UID) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
 	namespace := pc.podUIDNamespaceCache[key]
 	delete(pc.namespacePodUIDCache[namespace], key)
 	delete(pc.podUIDNamespaceCache, key)
@@ -64,16 +78,25 @@ func (pc *PodCache) DeleteByKey(key types.UID) {
 
 // GetLabels retrieves a pod's cached label set
 func (pc *PodCache) GetLabels(key types.UID) labels.Set {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
 	return pc.podUIDLabelCache[key]
 }
 
 // GetOwnerReferences retrieves a pod's cached owner references
 func (pc *PodCache) GetOwnerReferences(key types.UID) []metav1.OwnerReference {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
 	return pc.podUIDORCache[key]
 }
 
 // GetPodsInNamespace returns a list of pod UIDs given a namespace
 func (pc *PodCache) GetPodsInNamespace(namespace string) []types.UID {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
 	var pods []types.UID
 	if podsSet, exists := pc.namespacePodUIDCache[namespace]; exists {
 		for podUID := range podsSet {
@@ -86,15 +109,25 @@ func (pc *PodCache) GetPodsInNamespace(namespace string) []types.UID {
 // GetMatchingServices returns a list of service names that match the given
 // pod, given the services are in the cache arleady
 func (pc *PodCache) GetMatchingServices(podUID types.UID, sc *ServiceCache) []string {
+	pc.mu.RLock()
+	labelSet, exists := pc.podUIDLabelCache[podUID]
+	podNamespace := pc.podUIDNamespaceCache[podUID]
+	pc.mu.RUnlock()
+
 	var services []string
-	if labelSet, exists := pc.podUIDLabelCache[podUID]; exists {
-		for svcUID, selector := range sc.svcUIDSelectorCache {
-			if selector.Matches(labelSet) &&
-				sc.svcUIDNamespaceCache[svcUID] == pc.podUIDNamespaceCache[podUID] {
-				// update service:pods cache
-				sc.svcUIDPodsCache[svcUID][podUID] = true
-				services = append(services, sc.svcUIDNameCache[svcUID])
-			}
+	if !exists {
+		return services
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for svcUID, selector := range sc.svcUIDSelectorCache {
+		if selector.Matches(labelSet) &&
+			sc.svcUIDNamespaceCache[svcUID] == podNamespace {
+			// update service:pods cache
+			sc.svcUIDPodsCache[svcUID][podUID] = true
+			services = append(services, sc.svcUIDNameCache[svcUID])
 		}
 	}
 	return services
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"encoding/json"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// selectorExpressionsAnnotation is a convention used by several operators
+// to attach a richer set-based selector to a Service, since
+// v1.ServiceSpec.Selector only supports flat equality matches. The value
+// is a JSON-encoded []metav1.LabelSelectorRequirement that is layered on
+// top of the equality matches already present in Spec.Selector.
+const selectorExpressionsAnnotation = "selector-expressions.signalfx.com/match-expressions"
+
+// labelSelectorForService builds the *metav1.LabelSelector backing a
+// service's pod selection, preferring the richer selectorExpressionsAnnotation
+// convention when present and falling back to the legacy equality-only
+// Spec.Selector otherwise. A malformed annotation is treated the same as a
+// missing one so a typo can't take selection out entirely.
+func labelSelectorForService(svc *v1.Service) *metav1.LabelSelector {
+	labelSelector := &metav1.LabelSelector{MatchLabels: svc.Spec.Selector}
+
+	raw, ok := svc.Annotations[selectorExpressionsAnnotation]
+	if !ok || raw == "" {
+		return labelSelector
+	}
+
+	var exprs []metav1.LabelSelectorRequirement
+	if err := json.Unmarshal([]byte(raw), &exprs); err != nil {
+		return labelSelector
+	}
+	labelSelector.MatchExpressions = exprs
+	return labelSelector
+}
+
+// selectorForService resolves a service's full labels.Selector, honoring
+// set-based matchExpressions (In, NotIn, Exists, DoesNotExist) in addition
+// to the legacy equality Spec.Selector map.
+func selectorForService(svc *v1.Service) (labels.Selector, error) {
+	return metav1.LabelSelectorAsSelector(labelSelectorForService(svc))
+}
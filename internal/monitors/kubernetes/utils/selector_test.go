@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func serviceWithExpressions(t *testing.T, exprs []metav1.LabelSelectorRequirement) *v1.Service {
+	t.Helper()
+
+	raw, err := json.Marshal(exprs)
+	if err != nil {
+		t.Fatalf("marshaling test selector expressions: %v", err)
+	}
+
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				selectorExpressionsAnnotation: string(raw),
+			},
+		},
+	}
+}
+
+func TestSelectorForServiceOperators(t *testing.T) {
+	tests := []struct {
+		name    string
+		exprs   []metav1.LabelSelectorRequirement
+		labels  labels.Set
+		matches bool
+	}{
+		{
+			name: "In matches when value is in the list",
+			exprs: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"frontend", "backend"}},
+			},
+			labels:  labels.Set{"tier": "backend"},
+			matches: true,
+		},
+		{
+			name: "In does not match when value is absent from the list",
+			exprs: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"frontend", "backend"}},
+			},
+			labels:  labels.Set{"tier": "cache"},
+			matches: false,
+		},
+		{
+			name: "NotIn matches when value is outside the list",
+			exprs: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"frontend"}},
+			},
+			labels:  labels.Set{"tier": "backend"},
+			matches: true,
+		},
+		{
+			name: "NotIn does not match when value is in the list",
+			exprs: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"frontend"}},
+			},
+			labels:  labels.Set{"tier": "frontend"},
+			matches: false,
+		},
+		{
+			name: "Exists matches when the key is present regardless of value",
+			exprs: []metav1.LabelSelectorRequirement{
+				{Key: "canary", Operator: metav1.LabelSelectorOpExists},
+			},
+			labels:  labels.Set{"canary": "true"},
+			matches: true,
+		},
+		{
+			name: "Exists does not match when the key is absent",
+			exprs: []metav1.LabelSelectorRequirement{
+				{Key: "canary", Operator: metav1.LabelSelectorOpExists},
+			},
+			labels:  labels.Set{"tier": "backend"},
+			matches: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := serviceWithExpressions(t, tt.exprs)
+
+			selector, err := selectorForService(svc)
+			if err != nil {
+				t.Fatalf("selectorForService returned error: %v", err)
+			}
+
+			if got := selector.Matches(tt.labels); got != tt.matches {
+				t.Errorf("selector.Matches(%v) = %v, want %v", tt.labels, got, tt.matches)
+			}
+		})
+	}
+}
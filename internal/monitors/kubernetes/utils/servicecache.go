@@ -2,6 +2,7 @@ package utils
 
 import (
 	"reflect"
+	"sync"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -9,8 +10,12 @@ import (
 )
 
 // ServiceCache is used for holding values we care about from a pod
-// for quicker lookup than querying the API for them each time.
+// for quicker lookup than querying the API for them each time. It is
+// accessed concurrently from informer event handler goroutines and from
+// datapoint-enrichment goroutines, so all access goes through mu.
 type ServiceCache struct {
+	mu sync.RWMutex
+
 	svcUIDNamespaceCache map[types.UID]string
 	svcUIDNameCache      map[types.UID]string
 	svcUIDSelectorCache  map[types.UID]labels.Selector
@@ -30,7 +35,14 @@ func NewServiceCache() *ServiceCache {
 // IsCached checks if a service is already in the cache or if even of
 // the cached fields have changed.
 func (sc *ServiceCache) IsCached(svc *v1.Service) bool {
-	selector := labels.Set(svc.Spec.Selector).AsSelectorPreValidated()
+	selector, err := selectorForService(svc)
+	if err != nil {
+		return false
+	}
+
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
 	cachedNamespace := sc.svcUIDNamespaceCache[svc.UID]
 	cachedSelector := sc.svcUIDSelectorCache[svc.UID]
 	cachedName := sc.svcUIDNameCache[svc.UID]
@@ -40,13 +52,19 @@ func (sc *ServiceCache) IsCached(svc *v1.Service) bool {
 
 }
 
-// AddService adds or updates a service in cache
+// AddService adds or updates a service in cache. The service's selector is
+// resolved via selectorForService, so set-based matchExpressions are
+// honored in addition to the legacy equality Spec.Selector map.
 func (sc *ServiceCache) AddService(svc *v1.Service) {
-	selector := labels.Set(svc.Spec.Selector).AsSelectorPreValidated()
-	// empty selectors match nothing
-	if selector.Empty() {
+	selector, err := selectorForService(svc)
+	// empty or invalid selectors match nothing
+	if err != nil || selector.Empty() {
 		return
 	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
 	sc.svcUIDPodsCache[svc.UID] = make(map[types.UID]bool)
 	sc.svcUIDNamespaceCache[svc.UID] = svc.Namespace
 	sc.svcUIDSelectorCache[svc.UID] = selector
@@ -62,6 +80,9 @@ func (sc *ServiceCache) Delete(svc *v1.Service) {
 // Returns pods that were previously matched by this service
 // so their properties may be updated accordingly
 func (sc *ServiceCache) DeleteByKey(key types.UID) []types.UID {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
 	var pods []types.UID
 	for podUID := range sc.svcUIDPodsCache[key] {
 		pods = append(pods, podUID)
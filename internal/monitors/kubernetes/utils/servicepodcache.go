@@ -4,73 +4,410 @@ import (
 	"errors"
 	"reflect"
 	"sort"
+	"sync"
 
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 )
 
 // PodServiceCache is an internal cache for mapping
-// services to pods for property propagation.
+// services to pods for property propagation. It is accessed concurrently
+// from informer event handler goroutines and from datapoint-enrichment
+// goroutines, so all access goes through mu.
 type PodServiceCache struct {
-	svcUIDNamespaceCache map[types.UID]string
-	svcUIDNameCache      map[types.UID]string
-	svcUIDSelectorCache  map[types.UID]labels.Selector
-	podUIDLabelCache     map[types.UID]labels.Set
-	podUIDNamespaceCache map[types.UID]string
-	podSvcUIDCache       map[types.UID]svcSet
-	svcPodUIDCache       map[types.UID]podsSet
+	mu sync.RWMutex
+
+	svcUIDNamespaceCache     map[types.UID]string
+	svcUIDNameCache          map[types.UID]string
+	svcUIDSelectorCache      map[types.UID]labels.Selector
+	svcUIDLabelSelectorCache map[types.UID]*metav1.LabelSelector
+	podUIDLabelCache         map[types.UID]labels.Set
+	podUIDNamespaceCache     map[types.UID]string
+	podSvcUIDCache           map[types.UID]svcSet
+	svcPodUIDCache           map[types.UID]podsSet
+
+	// svcSelectorIndex indexes cached services by namespace -> label key ->
+	// label value -> service UIDs, derived from each service's equality
+	// (MatchLabels) selector requirements. It lets refreshCacheByPod narrow
+	// candidate services down to the ones that could possibly match a
+	// pod's labels, instead of scanning every cached service. Modeled on
+	// the indexer pattern used by client-go's SharedIndexInformer.
+	svcSelectorIndex map[string]map[string]map[string]svcSet
+
+	// svcExpressionOnlyIndex holds, per namespace, the services whose
+	// selector carries matchExpressions (In/NotIn/Exists/DoesNotExist).
+	// Those can't be narrowed by equality key/value indexing alone, so
+	// they're always included as match candidates for any pod in the
+	// same namespace; Selector.Matches still does the real filtering.
+	svcExpressionOnlyIndex map[string]svcSet
+
+	// podLabelIndex is the mirror of svcSelectorIndex: namespace -> label
+	// key -> label value -> pod UIDs. Used by refreshCacheByService to
+	// narrow candidate pods down for a service update.
+	podLabelIndex map[string]map[string]map[string]podsSet
+
+	// podNamespaceIndex holds every cached pod UID by namespace. It backs
+	// refreshCacheByService for services with matchExpressions, since
+	// those can't be narrowed down via podLabelIndex.
+	podNamespaceIndex map[string]podsSet
+
+	eventHandlers []PodServiceEventHandler
+
+	podsSynced     bool
+	servicesSynced bool
 }
 
 type svcSet map[types.UID]bool
 
 type podsSet map[types.UID]bool
 
+// PodServiceEventHandler is notified of matched-set changes as pods and
+// services are added, updated, or removed from a PodServiceCache. This
+// lets consumers react to diffs incrementally instead of re-scanning the
+// cache after every SetPod/SetService call, mirroring the
+// ResourceEventHandler pattern used by client-go informers.
+type PodServiceEventHandler interface {
+	// OnPodServicesChanged is called whenever the set of services matching
+	// a pod changes, with the service UIDs newly matched (added) and no
+	// longer matched (removed).
+	OnPodServicesChanged(podUID types.UID, added, removed []types.UID)
+	// OnServicePodsChanged is called whenever the set of pods matching a
+	// service changes, with the pod UIDs newly matched (added) and no
+	// longer matched (removed).
+	OnServicePodsChanged(svcUID types.UID, added, removed []types.UID)
+}
+
+// AddEventHandler registers a handler to be notified of pod:service
+// matched-set changes. Handlers are called synchronously from SetPod,
+// SetService, DeletePodFromCache, and DeleteServiceFromCache, but only
+// after those methods have released psc.mu, so a handler is free to call
+// back into psc (e.g. GetServiceNameForPodUID) without deadlocking.
+func (psc *PodServiceCache) AddEventHandler(h PodServiceEventHandler) {
+	psc.mu.Lock()
+	defer psc.mu.Unlock()
+
+	psc.eventHandlers = append(psc.eventHandlers, h)
+}
+
+// HasSynced returns true once both an initial pod list and an initial
+// service list have been fully processed by the cache. Consumers should
+// wait for this before acting on "no service matched pod" conditions, to
+// avoid spurious errors while the cache is still warming up.
+func (psc *PodServiceCache) HasSynced() bool {
+	psc.mu.RLock()
+	defer psc.mu.RUnlock()
+
+	return psc.podsSynced && psc.servicesSynced
+}
+
+// SetPodsSynced marks the initial pod list as fully processed.
+func (psc *PodServiceCache) SetPodsSynced() {
+	psc.mu.Lock()
+	defer psc.mu.Unlock()
+
+	psc.podsSynced = true
+}
+
+// SetServicesSynced marks the initial service list as fully processed.
+func (psc *PodServiceCache) SetServicesSynced() {
+	psc.mu.Lock()
+	defer psc.mu.Unlock()
+
+	psc.servicesSynced = true
+}
+
+// diffUIDSet compares a before/after snapshot of a UID set and returns the
+// UIDs that were added and removed.
+func diffUIDSet(before, after map[types.UID]bool) (added, removed []types.UID) {
+	for uid := range after {
+		if !before[uid] {
+			added = append(added, uid)
+		}
+	}
+	for uid := range before {
+		if !after[uid] {
+			removed = append(removed, uid)
+		}
+	}
+	return added, removed
+}
+
+// copyUIDSet returns a shallow copy of a UID set, used to snapshot matched
+// sets before they are mutated by a refresh so they can be diffed
+// afterward.
+func copyUIDSet(set map[types.UID]bool) map[types.UID]bool {
+	cp := make(map[types.UID]bool, len(set))
+	for uid := range set {
+		cp[uid] = true
+	}
+	return cp
+}
+
 // NewPodServiceCache creates a new service:pod cache
 func NewPodServiceCache() *PodServiceCache {
 	return &PodServiceCache{
-		svcUIDNamespaceCache: make(map[types.UID]string),
-		svcUIDNameCache:      make(map[types.UID]string),
-		svcUIDSelectorCache:  make(map[types.UID]labels.Selector),
-		podUIDLabelCache:     make(map[types.UID]labels.Set),
-		podUIDNamespaceCache: make(map[types.UID]string),
-		podSvcUIDCache:       make(map[types.UID]svcSet),
-		svcPodUIDCache:       make(map[types.UID]podsSet),
+		svcUIDNamespaceCache:     make(map[types.UID]string),
+		svcUIDNameCache:          make(map[types.UID]string),
+		svcUIDSelectorCache:      make(map[types.UID]labels.Selector),
+		svcUIDLabelSelectorCache: make(map[types.UID]*metav1.LabelSelector),
+		podUIDLabelCache:         make(map[types.UID]labels.Set),
+		podUIDNamespaceCache:     make(map[types.UID]string),
+		podSvcUIDCache:           make(map[types.UID]svcSet),
+		svcPodUIDCache:           make(map[types.UID]podsSet),
+		svcSelectorIndex:         make(map[string]map[string]map[string]svcSet),
+		svcExpressionOnlyIndex:   make(map[string]svcSet),
+		podLabelIndex:            make(map[string]map[string]map[string]podsSet),
+		podNamespaceIndex:        make(map[string]podsSet),
+	}
+}
+
+// indexService adds a service's selector requirements to svcSelectorIndex
+// (for its equality MatchLabels) and, when it carries matchExpressions, to
+// svcExpressionOnlyIndex, so it can be found as a match candidate for
+// pods in the service's namespace.
+func (psc *PodServiceCache) indexService(namespace string, svcUID types.UID, labelSelector *metav1.LabelSelector) {
+	for k, v := range labelSelector.MatchLabels {
+		byKey, exists := psc.svcSelectorIndex[namespace]
+		if !exists {
+			byKey = make(map[string]map[string]svcSet)
+			psc.svcSelectorIndex[namespace] = byKey
+		}
+		byValue, exists := byKey[k]
+		if !exists {
+			byValue = make(map[string]svcSet)
+			byKey[k] = byValue
+		}
+		uids, exists := byValue[v]
+		if !exists {
+			uids = make(svcSet)
+			byValue[v] = uids
+		}
+		uids[svcUID] = true
+	}
+
+	if len(labelSelector.MatchExpressions) > 0 {
+		uids, exists := psc.svcExpressionOnlyIndex[namespace]
+		if !exists {
+			uids = make(svcSet)
+			psc.svcExpressionOnlyIndex[namespace] = uids
+		}
+		uids[svcUID] = true
+	}
+}
+
+// deindexService removes a service's selector requirements from
+// svcSelectorIndex and svcExpressionOnlyIndex, given the namespace and
+// selector it was previously indexed under.
+func (psc *PodServiceCache) deindexService(namespace string, svcUID types.UID, labelSelector *metav1.LabelSelector) {
+	for k, v := range labelSelector.MatchLabels {
+		if uids, exists := psc.svcSelectorIndex[namespace][k][v]; exists {
+			delete(uids, svcUID)
+		}
+	}
+	delete(psc.svcExpressionOnlyIndex[namespace], svcUID)
+}
+
+// indexPod adds a pod's labels to podLabelIndex and podNamespaceIndex so it
+// can be found as a match candidate for any service whose selector
+// references one of these label key/value pairs (or carries
+// matchExpressions) in the pod's namespace.
+func (psc *PodServiceCache) indexPod(namespace string, podUID types.UID, labelSet labels.Set) {
+	for k, v := range labelSet {
+		byKey, exists := psc.podLabelIndex[namespace]
+		if !exists {
+			byKey = make(map[string]map[string]podsSet)
+			psc.podLabelIndex[namespace] = byKey
+		}
+		byValue, exists := byKey[k]
+		if !exists {
+			byValue = make(map[string]podsSet)
+			byKey[k] = byValue
+		}
+		uids, exists := byValue[v]
+		if !exists {
+			uids = make(podsSet)
+			byValue[v] = uids
+		}
+		uids[podUID] = true
+	}
+
+	nsPods, exists := psc.podNamespaceIndex[namespace]
+	if !exists {
+		nsPods = make(podsSet)
+		psc.podNamespaceIndex[namespace] = nsPods
+	}
+	nsPods[podUID] = true
+}
+
+// deindexPod removes a pod's labels from podLabelIndex and
+// podNamespaceIndex, given the namespace and label set it was previously
+// indexed under.
+func (psc *PodServiceCache) deindexPod(namespace string, podUID types.UID, labelSet labels.Set) {
+	for k, v := range labelSet {
+		if uids, exists := psc.podLabelIndex[namespace][k][v]; exists {
+			delete(uids, podUID)
+		}
+	}
+	delete(psc.podNamespaceIndex[namespace], podUID)
+}
+
+// candidatePodsForService returns the set of pod UIDs, in the service's
+// namespace, that could possibly match the service's selector. When the
+// selector carries matchExpressions it falls back to every pod in the
+// namespace, since set-based requirements can't be narrowed by equality
+// indexing; otherwise it's narrowed to pods sharing a label key/value pair
+// with the selector's MatchLabels. Either way this is a superset of the
+// pods that actually match -- callers must still run Selector.Matches.
+func (psc *PodServiceCache) candidatePodsForService(namespace string, labelSelector *metav1.LabelSelector) podsSet {
+	if len(labelSelector.MatchExpressions) > 0 {
+		return psc.podNamespaceIndex[namespace]
 	}
+
+	candidates := make(podsSet)
+	for k, v := range labelSelector.MatchLabels {
+		for podUID := range psc.podLabelIndex[namespace][k][v] {
+			candidates[podUID] = true
+		}
+	}
+	return candidates
+}
+
+// candidateServicesForPod returns the set of service UIDs, in the pod's
+// namespace, that could possibly match the pod's labels: services sharing
+// a label key/value pair with the pod (via svcSelectorIndex), plus every
+// service in the namespace with matchExpressions (via
+// svcExpressionOnlyIndex), since those can't be narrowed by equality
+// indexing. This is a superset of the services that actually match --
+// callers must still run Selector.Matches on it.
+func (psc *PodServiceCache) candidateServicesForPod(namespace string, labelSet labels.Set) svcSet {
+	candidates := make(svcSet)
+	for k, v := range labelSet {
+		for svcUID := range psc.svcSelectorIndex[namespace][k][v] {
+			candidates[svcUID] = true
+		}
+	}
+	for svcUID := range psc.svcExpressionOnlyIndex[namespace] {
+		candidates[svcUID] = true
+	}
+	return candidates
 }
 
 // SetService attempts to add a new service to the cache or update
 // an existing service in the cache. We only really care about the service
 // name or selector changing for re-mapping the pod:service relationships.
 // If there is an update to a service but neither of these change,
-// it is a no-op for us
+// it is a no-op for us. The selector is resolved via selectorForService,
+// so set-based matchExpressions are honored in addition to the legacy
+// equality Spec.Selector map.
 func (psc *PodServiceCache) SetService(svc *v1.Service) {
-	selector := labels.Set(svc.Spec.Selector).AsSelectorPreValidated()
-	if selector.Empty() {
+	psc.mu.Lock()
+
+	labelSelector := labelSelectorForService(svc)
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil || selector.Empty() {
+		psc.mu.Unlock()
 		return
 	}
 
 	cachedNamespace := psc.svcUIDNamespaceCache[svc.UID]
 	cachedSelector := psc.svcUIDSelectorCache[svc.UID]
+	cachedLabelSelector := psc.svcUIDLabelSelectorCache[svc.UID]
 	cachedName := psc.svcUIDNameCache[svc.UID]
 
 	// if already cached & selector, name, namespace did not change, no-op.
 	if (reflect.DeepEqual(cachedSelector, selector)) &&
 		(cachedName == svc.Name) && (cachedNamespace == svc.Namespace) {
+		psc.mu.Unlock()
 		return
 	}
 
+	if cachedLabelSelector != nil {
+		psc.deindexService(cachedNamespace, svc.UID, cachedLabelSelector)
+	}
+
+	before := copyUIDSet(psc.svcPodUIDCache[svc.UID])
+
+	// Drop the prior matches so refreshCacheByService rebuilds them from
+	// the new selector, and pods that no longer match show up as removed.
+	for podUID := range psc.svcPodUIDCache[svc.UID] {
+		delete(psc.podSvcUIDCache[podUID], svc.UID)
+	}
+	delete(psc.svcPodUIDCache, svc.UID)
+
 	psc.svcUIDNamespaceCache[svc.UID] = svc.Namespace
 	psc.svcUIDSelectorCache[svc.UID] = selector
+	psc.svcUIDLabelSelectorCache[svc.UID] = labelSelector
 	psc.svcUIDNameCache[svc.UID] = svc.Name
+	psc.indexService(svc.Namespace, svc.UID, labelSelector)
 	psc.refreshCacheByService(svc)
+
+	added, removed := psc.diffServicePodsChanged(svc.UID, before)
+	psc.mu.Unlock()
+
+	psc.notifyServicePodsChanged(svc.UID, added, removed)
+}
+
+// diffServicePodsChanged diffs the service's matched pod set against its
+// prior state, under psc.mu. It must be called with psc.mu held, and must
+// not itself invoke event handlers: handlers are notified by
+// notifyServicePodsChanged only after psc.mu has been released, so a
+// handler that calls back into psc (e.g. GetServiceNameForPodUID) can't
+// deadlock against the lock its own dispatch is running under.
+func (psc *PodServiceCache) diffServicePodsChanged(svcUID types.UID, before map[types.UID]bool) (added, removed []types.UID) {
+	if len(psc.eventHandlers) == 0 {
+		return nil, nil
+	}
+	return diffUIDSet(before, psc.svcPodUIDCache[svcUID])
+}
+
+// diffPodServicesChanged diffs the pod's matched service set against its
+// prior state, under psc.mu. See diffServicePodsChanged for why this does
+// not itself notify handlers.
+func (psc *PodServiceCache) diffPodServicesChanged(podUID types.UID, before map[types.UID]bool) (added, removed []types.UID) {
+	if len(psc.eventHandlers) == 0 {
+		return nil, nil
+	}
+	return diffUIDSet(before, psc.podSvcUIDCache[podUID])
+}
+
+// notifyServicePodsChanged calls OnServicePodsChanged on every registered
+// event handler. Callers must invoke this after releasing psc.mu, never
+// while holding it -- see diffServicePodsChanged.
+func (psc *PodServiceCache) notifyServicePodsChanged(svcUID types.UID, added, removed []types.UID) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	for _, h := range psc.eventHandlers {
+		h.OnServicePodsChanged(svcUID, added, removed)
+	}
+}
+
+// notifyPodServicesChanged calls OnPodServicesChanged on every registered
+// event handler. Callers must invoke this after releasing psc.mu, never
+// while holding it -- see diffPodServicesChanged.
+func (psc *PodServiceCache) notifyPodServicesChanged(podUID types.UID, added, removed []types.UID) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	for _, h := range psc.eventHandlers {
+		h.OnPodServicesChanged(podUID, added, removed)
+	}
 }
 
 // DeleteServiceFromCache takes a service and removes it from all
 // internal caches.
 func (psc *PodServiceCache) DeleteServiceFromCache(svcUID types.UID) {
+	psc.mu.Lock()
+
+	if labelSelector, exists := psc.svcUIDLabelSelectorCache[svcUID]; exists {
+		psc.deindexService(psc.svcUIDNamespaceCache[svcUID], svcUID, labelSelector)
+	}
+	before := copyUIDSet(psc.svcPodUIDCache[svcUID])
 	delete(psc.svcUIDNamespaceCache, svcUID)
 	delete(psc.svcUIDSelectorCache, svcUID)
+	delete(psc.svcUIDLabelSelectorCache, svcUID)
 	delete(psc.svcUIDNameCache, svcUID)
 	if podsSet, exists := psc.svcPodUIDCache[svcUID]; exists {
 		for podUID := range podsSet {
@@ -78,12 +415,18 @@ func (psc *PodServiceCache) DeleteServiceFromCache(svcUID types.UID) {
 		}
 		delete(psc.svcPodUIDCache, svcUID)
 	}
+	added, removed := psc.diffServicePodsChanged(svcUID, before)
+	psc.mu.Unlock()
+
+	psc.notifyServicePodsChanged(svcUID, added, removed)
 }
 
 // SetPod attempts to add a new pod to the cache or update an
 // existing one. After a pod is added or updated, we need to check
 // cached services to find which ones match
 func (psc *PodServiceCache) SetPod(pod *v1.Pod) {
+	psc.mu.Lock()
+
 	labelSet := labels.Set(pod.Labels)
 	cachedLabelSet := psc.podUIDLabelCache[pod.UID]
 	cachedNamespace := psc.podUIDNamespaceCache[pod.UID]
@@ -91,17 +434,43 @@ func (psc *PodServiceCache) SetPod(pod *v1.Pod) {
 	// if the pod label set didn't change, no-op
 	if reflect.DeepEqual(cachedLabelSet, labelSet) &&
 		cachedNamespace == pod.Namespace {
+		psc.mu.Unlock()
 		return
 	}
 
+	if cachedLabelSet != nil {
+		psc.deindexPod(cachedNamespace, pod.UID, cachedLabelSet)
+	}
+
+	before := copyUIDSet(psc.podSvcUIDCache[pod.UID])
+
+	// Drop the prior matches so refreshCacheByPod rebuilds them from the
+	// new labels, and services that no longer match show up as removed.
+	for svcUID := range psc.podSvcUIDCache[pod.UID] {
+		delete(psc.svcPodUIDCache[svcUID], pod.UID)
+	}
+	delete(psc.podSvcUIDCache, pod.UID)
+
 	psc.podUIDNamespaceCache[pod.UID] = pod.Namespace
 	psc.podUIDLabelCache[pod.UID] = labelSet
+	psc.indexPod(pod.Namespace, pod.UID, labelSet)
 	psc.refreshCacheByPod(pod)
+
+	added, removed := psc.diffPodServicesChanged(pod.UID, before)
+	psc.mu.Unlock()
+
+	psc.notifyPodServicesChanged(pod.UID, added, removed)
 }
 
 // DeletePodFromCache takes a pod and removes it from all
 // internal caches
 func (psc *PodServiceCache) DeletePodFromCache(podUID types.UID) {
+	psc.mu.Lock()
+
+	if labelSet, exists := psc.podUIDLabelCache[podUID]; exists {
+		psc.deindexPod(psc.podUIDNamespaceCache[podUID], podUID, labelSet)
+	}
+	before := copyUIDSet(psc.podSvcUIDCache[podUID])
 	delete(psc.podUIDNamespaceCache, podUID)
 	delete(psc.podUIDLabelCache, podUID)
 	if servicesSet, exists := psc.podSvcUIDCache[podUID]; exists {
@@ -110,29 +479,41 @@ func (psc *PodServiceCache) DeletePodFromCache(podUID types.UID) {
 		}
 		delete(psc.podSvcUIDCache, podUID)
 	}
+	added, removed := psc.diffPodServicesChanged(podUID, before)
+	psc.mu.Unlock()
+
+	psc.notifyPodServicesChanged(podUID, added, removed)
 }
 
 // refreshCacheByService should be called when a service is added
 // or updated and the pod:service mappings need to be refreshed.
-// This function loops through all pods in the cache and checks if
-// any match the given service.
+// Rather than scanning every cached pod, it only considers pods that
+// share a label key/value pair with the service's selector (via
+// podLabelIndex), or every pod in the service's namespace when the
+// selector carries matchExpressions (see candidatePodsForService), then
+// verifies each candidate with Selector.Matches.
 func (psc *PodServiceCache) refreshCacheByService(svc *v1.Service) []types.UID {
 	var pods []types.UID
-	if selector, exists := psc.svcUIDSelectorCache[svc.UID]; exists {
-		for podUID, labelSet := range psc.podUIDLabelCache {
-			if selector.Matches(labelSet) &&
-				psc.podUIDNamespaceCache[podUID] == svc.Namespace {
-				if _, exists := psc.podSvcUIDCache[podUID]; !exists {
-					psc.podSvcUIDCache[podUID] = make(map[types.UID]bool)
-
-				}
-				if _, exists := psc.svcPodUIDCache[svc.UID]; !exists {
-					psc.svcPodUIDCache[svc.UID] = make(map[types.UID]bool)
-				}
-				pods = append(pods, podUID)
-				psc.podSvcUIDCache[podUID][svc.UID] = true
-				psc.svcPodUIDCache[svc.UID][podUID] = true
+	selector, exists := psc.svcUIDSelectorCache[svc.UID]
+	if !exists {
+		return pods
+	}
+	labelSelector := psc.svcUIDLabelSelectorCache[svc.UID]
+
+	for podUID := range psc.candidatePodsForService(svc.Namespace, labelSelector) {
+		labelSet := psc.podUIDLabelCache[podUID]
+		if selector.Matches(labelSet) &&
+			psc.podUIDNamespaceCache[podUID] == svc.Namespace {
+			if _, exists := psc.podSvcUIDCache[podUID]; !exists {
+				psc.podSvcUIDCache[podUID] = make(map[types.UID]bool)
+
+			}
+			if _, exists := psc.svcPodUIDCache[svc.UID]; !exists {
+				psc.svcPodUIDCache[svc.UID] = make(map[types.UID]bool)
 			}
+			pods = append(pods, podUID)
+			psc.podSvcUIDCache[podUID][svc.UID] = true
+			psc.svcPodUIDCache[svc.UID][podUID] = true
 		}
 	}
 	return pods
@@ -140,25 +521,32 @@ func (psc *PodServiceCache) refreshCacheByService(svc *v1.Service) []types.UID {
 
 // refreshCacheByPod should be called when a pod is added
 // or updated and the pod:service mappings need to be refreshed.
-// This function loops through all services in the cache and checks if
-// any match the given pod.
+// Rather than scanning every cached service, it only considers services
+// that share a label key/value pair with the pod (via svcSelectorIndex),
+// plus every service in the pod's namespace whose selector carries
+// matchExpressions (see candidateServicesForPod), then verifies each
+// candidate with Selector.Matches.
 func (psc *PodServiceCache) refreshCacheByPod(pod *v1.Pod) []types.UID {
 	var services []types.UID
-	if labelSet, exists := psc.podUIDLabelCache[pod.UID]; exists {
-		for svcUID, selector := range psc.svcUIDSelectorCache {
-			if selector.Matches(labelSet) &&
-				psc.svcUIDNamespaceCache[svcUID] == pod.Namespace {
-				if _, exists := psc.podSvcUIDCache[pod.UID]; !exists {
-					psc.podSvcUIDCache[pod.UID] = make(map[types.UID]bool)
-
-				}
-				if _, exists := psc.svcPodUIDCache[svcUID]; !exists {
-					psc.svcPodUIDCache[svcUID] = make(map[types.UID]bool)
-				}
-				services = append(services, svcUID)
-				psc.podSvcUIDCache[pod.UID][svcUID] = true
-				psc.svcPodUIDCache[svcUID][pod.UID] = true
+	labelSet, exists := psc.podUIDLabelCache[pod.UID]
+	if !exists {
+		return services
+	}
+
+	for svcUID := range psc.candidateServicesForPod(pod.Namespace, labelSet) {
+		selector := psc.svcUIDSelectorCache[svcUID]
+		if selector.Matches(labelSet) &&
+			psc.svcUIDNamespaceCache[svcUID] == pod.Namespace {
+			if _, exists := psc.podSvcUIDCache[pod.UID]; !exists {
+				psc.podSvcUIDCache[pod.UID] = make(map[types.UID]bool)
+
+			}
+			if _, exists := psc.svcPodUIDCache[svcUID]; !exists {
+				psc.svcPodUIDCache[svcUID] = make(map[types.UID]bool)
 			}
+			services = append(services, svcUID)
+			psc.podSvcUIDCache[pod.UID][svcUID] = true
+			psc.svcPodUIDCache[svcUID][pod.UID] = true
 		}
 	}
 	return services
@@ -173,6 +561,9 @@ func (psc *PodServiceCache) GetPodUIDsForService(svc *v1.Service) []types.UID {
 // GetPodUIDsForServiceUID looks up a service in the cache and returns
 // the pods that match the services selector.
 func (psc *PodServiceCache) GetPodUIDsForServiceUID(svcUID types.UID) []types.UID {
+	psc.mu.RLock()
+	defer psc.mu.RUnlock()
+
 	var pods []types.UID
 	if podSet, exists := psc.svcPodUIDCache[svcUID]; exists {
 		for podUID := range podSet {
@@ -200,6 +591,9 @@ func (psc *PodServiceCache) getServiceNamesForPod(pod *v1.Pod) []string {
 // Selection method is sorting strings alphabetically and selecting the
 // first service off the top.
 func (psc *PodServiceCache) GetServiceNameForPod(pod *v1.Pod) (string, error) {
+	psc.mu.RLock()
+	defer psc.mu.RUnlock()
+
 	var service string
 	services := psc.getServiceNamesForPod(pod)
 	if len(services) == 0 {
@@ -228,6 +622,9 @@ func (psc *PodServiceCache) getServiceNamesForPodUID(podUID types.UID) []string
 // Selection method is sorting strings alphabetically and selecting the
 // first service off the top.
 func (psc *PodServiceCache) GetServiceNameForPodUID(podUID types.UID) (string, error) {
+	psc.mu.RLock()
+	defer psc.mu.RUnlock()
+
 	var service string
 	services := psc.getServiceNamesForPodUID(podUID)
 	if len(services) == 0 {
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// benchPods and benchServices build a 5k-pod / 500-service cluster shape,
+// the scale at which an O(P*S) selector scan on every SetPod/SetService
+// call becomes the dominant cost -- exactly what svcSelectorIndex/
+// podLabelIndex exist to avoid.
+func benchPods(n int) []*v1.Pod {
+	pods := make([]*v1.Pod, n)
+	for i := range pods {
+		pods[i] = &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				UID:       types.UID(fmt.Sprintf("pod-%d", i)),
+				Namespace: "default",
+				Labels:    map[string]string{"tier": fmt.Sprintf("tier-%d", i%500)},
+			},
+		}
+	}
+	return pods
+}
+
+func benchServices(n int) []*v1.Service {
+	services := make([]*v1.Service, n)
+	for i := range services {
+		services[i] = &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				UID:       types.UID(fmt.Sprintf("svc-%d", i)),
+				Namespace: "default",
+				Name:      fmt.Sprintf("svc-%d", i),
+			},
+			Spec: v1.ServiceSpec{
+				Selector: map[string]string{"tier": fmt.Sprintf("tier-%d", i)},
+			},
+		}
+	}
+	return services
+}
+
+// BenchmarkPodServiceCache_InitialLoad measures loading a 5k-pod /
+// 500-service cluster from a cold cache, the cold-start path every
+// agent goes through on startup.
+func BenchmarkPodServiceCache_InitialLoad(b *testing.B) {
+	pods := benchPods(5000)
+	services := benchServices(500)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		psc := NewPodServiceCache()
+		for _, svc := range services {
+			psc.SetService(svc)
+		}
+		for _, pod := range pods {
+			psc.SetPod(pod)
+		}
+	}
+}
+
+// BenchmarkPodServiceCache_SetPod measures the steady-state cost of a
+// single pod update (e.g. a resync or status change) against an
+// already-warm 5k-pod / 500-service cache -- the indexed lookup in
+// refreshCacheByPod should make this independent of cluster size rather
+// than scaling with the number of cached services.
+func BenchmarkPodServiceCache_SetPod(b *testing.B) {
+	psc := NewPodServiceCache()
+	for _, svc := range benchServices(500) {
+		psc.SetService(svc)
+	}
+	pods := benchPods(5000)
+	for _, pod := range pods {
+		psc.SetPod(pod)
+	}
+
+	pod := pods[0]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Alternate labels each iteration so SetPod doesn't short-circuit
+		// on the no-op "labels didn't change" path. A fresh map is needed:
+		// the cache keeps the pod's own label map, so mutating it in place
+		// would make the cached and new labels always compare equal.
+		pod.Labels = map[string]string{"tier": fmt.Sprintf("tier-%d", i%500)}
+		psc.SetPod(pod)
+	}
+}
+
+// BenchmarkPodServiceCache_SetService measures the steady-state cost of
+// a single service update against an already-warm 5k-pod / 500-service
+// cache, via the indexed lookup in refreshCacheByService.
+func BenchmarkPodServiceCache_SetService(b *testing.B) {
+	psc := NewPodServiceCache()
+	services := benchServices(500)
+	for _, svc := range services {
+		psc.SetService(svc)
+	}
+	for _, pod := range benchPods(5000) {
+		psc.SetPod(pod)
+	}
+
+	svc := services[0]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		svc.Spec.Selector["tier"] = fmt.Sprintf("tier-%d", i%500)
+		psc.SetService(svc)
+	}
+}
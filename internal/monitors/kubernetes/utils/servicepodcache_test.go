@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TestPodServiceCacheConcurrentAccess drives SetPod, SetService, and
+// GetServiceNameForPod from many goroutines at once. It exists to be run
+// with -race: PodServiceCache is documented as being accessed
+// concurrently from informer event handler goroutines and from
+// datapoint-enrichment goroutines, so every exported method needs to be
+// safe under that usage.
+func TestPodServiceCacheConcurrentAccess(t *testing.T) {
+	const (
+		numPods     = 50
+		numServices = 10
+		numRounds   = 20
+	)
+
+	psc := NewPodServiceCache()
+
+	pods := make([]*v1.Pod, numPods)
+	for i := range pods {
+		pods[i] = &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				UID:       types.UID(fmt.Sprintf("pod-%d", i)),
+				Namespace: "default",
+				Labels:    map[string]string{"tier": fmt.Sprintf("tier-%d", i%numServices)},
+			},
+		}
+	}
+
+	services := make([]*v1.Service, numServices)
+	for i := range services {
+		services[i] = &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				UID:       types.UID(fmt.Sprintf("svc-%d", i)),
+				Namespace: "default",
+				Name:      fmt.Sprintf("svc-%d", i),
+			},
+			Spec: v1.ServiceSpec{
+				Selector: map[string]string{"tier": fmt.Sprintf("tier-%d", i)},
+			},
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	for round := 0; round < numRounds; round++ {
+		for _, pod := range pods {
+			wg.Add(1)
+			go func(pod *v1.Pod) {
+				defer wg.Done()
+				psc.SetPod(pod)
+				_, _ = psc.GetServiceNameForPod(pod)
+			}(pod)
+		}
+		for _, svc := range services {
+			wg.Add(1)
+			go func(svc *v1.Service) {
+				defer wg.Done()
+				psc.SetService(svc)
+				_ = psc.GetPodUIDsForService(svc)
+			}(svc)
+		}
+	}
+
+	wg.Wait()
+
+	psc.SetPodsSynced()
+	psc.SetServicesSynced()
+	if !psc.HasSynced() {
+		t.Fatal("expected HasSynced to be true after SetPodsSynced/SetServicesSynced")
+	}
+
+	for i, pod := range pods {
+		service, err := psc.GetServiceNameForPod(pod)
+		if err != nil {
+			t.Errorf("pod %d: expected a matching service, got error: %v", i, err)
+			continue
+		}
+		if want := fmt.Sprintf("svc-%d", i%numServices); service != want {
+			t.Errorf("pod %d: got service %q, want %q", i, service, want)
+		}
+	}
+}
+
+// callbackHandler is a PodServiceEventHandler that calls back into the
+// PodServiceCache from its own callback, mimicking DatapointCache's
+// updateServicePropForPods, which resolves the affected pod's service via
+// GetServiceNameForPodUID from inside OnPodServicesChanged/
+// OnServicePodsChanged.
+type callbackHandler struct {
+	psc *PodServiceCache
+}
+
+func (h *callbackHandler) OnPodServicesChanged(podUID types.UID, added, removed []types.UID) {
+	_, _ = h.psc.GetServiceNameForPodUID(podUID)
+}
+
+func (h *callbackHandler) OnServicePodsChanged(svcUID types.UID, added, removed []types.UID) {
+	for _, podUID := range append(added, removed...) {
+		_, _ = h.psc.GetServiceNameForPodUID(podUID)
+	}
+}
+
+// TestPodServiceCacheHandlerCallbackDoesNotDeadlock is a regression test
+// for a self-deadlock: SetPod/SetService/DeletePodFromCache/
+// DeleteServiceFromCache must release psc.mu before notifying registered
+// PodServiceEventHandlers, since a handler (like DatapointCache) calling
+// back into a locking method such as GetServiceNameForPodUID would
+// otherwise block forever against the non-reentrant RWMutex. Each call
+// below is run on its own goroutine with a deadline, so a regression
+// hangs this test instead of the whole suite.
+func TestPodServiceCacheHandlerCallbackDoesNotDeadlock(t *testing.T) {
+	psc := NewPodServiceCache()
+	psc.AddEventHandler(&callbackHandler{psc: psc})
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:       types.UID("pod-0"),
+			Namespace: "default",
+			Labels:    map[string]string{"tier": "backend"},
+		},
+	}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:       types.UID("svc-0"),
+			Namespace: "default",
+			Name:      "svc-0",
+		},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{"tier": "backend"},
+		},
+	}
+
+	const deadline = 5 * time.Second
+
+	runWithDeadline := func(name string, fn func()) {
+		done := make(chan struct{})
+		go func() {
+			fn()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(deadline):
+			t.Fatalf("%s did not return within %s -- likely deadlocked calling back into the cache", name, deadline)
+		}
+	}
+
+	runWithDeadline("SetPod", func() { psc.SetPod(pod) })
+	runWithDeadline("SetService", func() { psc.SetService(svc) })
+	runWithDeadline("DeletePodFromCache", func() { psc.DeletePodFromCache(pod.UID) })
+	runWithDeadline("DeleteServiceFromCache", func() { psc.DeleteServiceFromCache(svc.UID) })
+}
@@ -39,19 +39,115 @@ func validateConfig(monConfig config.MonitorCustomConfig) error {
 		return errors.New("configEndpointMappings is not useful without a discovery rule")
 	}
 
-	if err := validation.ValidateStruct(monConfig); err != nil {
+	// A config with a discovery rule won't have its endpoint-derived
+	// fields (e.g. Host/Port) populated yet, so it can never pass plain
+	// struct validation -- use the sentinel-backed validator instead so
+	// unrelated config mistakes still surface at load time.
+	if conf.DiscoveryRule != "" {
+		if err := validateConfigWithDiscoveryRule(monConfig); err != nil {
+			return err
+		}
+	} else if err := validation.ValidateStruct(monConfig); err != nil {
 		return err
 	}
 
 	return validation.ValidateCustomConfig(monConfig)
 }
 
+// endpointHostSentinel and endpointPortSentinel are substituted into
+// discovery-derived fields before validation so that `required` struct
+// tags on them don't fail config-load-time validation, which runs before
+// an endpoint has actually been discovered.
+const endpointHostSentinel = "__discovery_pending__"
+
+var endpointPortSentinel = uint16(0xFFFF)
+
+// EndpointConfig holds the Host/Port that a discovery rule resolves onto a
+// monitor config. Monitors that accept discovery rules (MonitorConfig's
+// `acceptsEndpoints:"true"` tag) should embed this rather than declaring
+// their own Host/Port fields, so the `endpointField:"true"` tag that
+// fillEndpointFields relies on is always present -- a hand-rolled Host/Port
+// pair is easy to add without remembering the tag, which left discovery-rule
+// monitors failing upfront validation on fields they don't have yet.
+type EndpointConfig struct {
+	Host string `yaml:"host" validate:"required" endpointField:"true"`
+	Port uint16 `yaml:"port" validate:"required" endpointField:"true"`
+}
+
 // Configuration with discovery rules is a bit tricky to validate since in its
 // given form, it will never validate since there is no host/port.  But we need
 // a way to give upfront feedback if there are other validation issues with the
 // config since otherwise the user has to wait until the endpoint has been
 // discovered and the monitor tries to initialize to see validation errors.
+//
+// This works by operating on a copy of monConfig with every field tagged
+// `endpointField:"true"` (Host/Port) temporarily set to a sentinel value,
+// then running normal struct validation and filtering out the `required`
+// violations that sentinel-filling was meant to suppress. Any other
+// struct-tag or Validate() error is still surfaced.
 func validateConfigWithDiscoveryRule(monConfig config.MonitorCustomConfig) error {
+	confCopy, endpointFields := copyWithEndpointFieldsFilled(monConfig)
+
+	err := validation.ValidateStruct(confCopy)
+	if err == nil {
+		return nil
+	}
+
+	valErr, ok := err.(*validation.Error)
+	if !ok {
+		return err
+	}
+
+	return valErr.WithoutRequiredViolationsFor(endpointFields)
+}
+
+// copyWithEndpointFieldsFilled returns a copy of monConfig with every
+// field tagged `endpointField:"true"` set to a sentinel value (so
+// `required` validation on them doesn't fail ahead of discovery), along
+// with the set of Go field names that were filled in.
+func copyWithEndpointFieldsFilled(monConfig config.MonitorCustomConfig) (config.MonitorCustomConfig, map[string]bool) {
+	orig := reflect.ValueOf(monConfig)
+	origElem := reflect.Indirect(orig)
+
+	cp := reflect.New(origElem.Type())
+	cp.Elem().Set(origElem)
+
+	endpointFields := make(map[string]bool)
+	fillEndpointFields(cp.Elem(), endpointFields)
+
+	return cp.Interface().(config.MonitorCustomConfig), endpointFields
+}
+
+// fillEndpointFields walks val (and any embedded/nested structs)
+// recursively, setting the sentinel value on any field tagged
+// `endpointField:"true"` and recording its Go field name.
+func fillEndpointFields(val reflect.Value, endpointFields map[string]bool) {
+	if val.Kind() != reflect.Struct {
+		return
+	}
+
+	t := val.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldVal := val.Field(i)
+
+		if field.Tag.Get("endpointField") == "true" && fieldVal.CanSet() {
+			endpointFields[field.Name] = true
+			switch fieldVal.Kind() {
+			case reflect.String:
+				fieldVal.SetString(endpointHostSentinel)
+			case reflect.Uint16, reflect.Uint, reflect.Uint32, reflect.Uint64:
+				fieldVal.SetUint(uint64(endpointPortSentinel))
+			case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+				fieldVal.SetInt(int64(endpointPortSentinel))
+			}
+			continue
+		}
+
+		if fieldVal.Kind() == reflect.Struct {
+			fillEndpointFields(fieldVal, endpointFields)
+		}
+	}
 }
 
 func configAcceptsEndpoints(monConfig config.MonitorCustomConfig) bool {
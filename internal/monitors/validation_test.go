@@ -0,0 +1,42 @@
+package monitors
+
+import (
+	"reflect"
+	"testing"
+)
+
+// discoveryAwareTestConfig mimics a monitor config that accepts discovery
+// rules by embedding EndpointConfig for its Host/Port, the pattern
+// EndpointConfig exists to make the default.
+type discoveryAwareTestConfig struct {
+	EndpointConfig `yaml:",inline"`
+
+	Name string `yaml:"name" validate:"required"`
+}
+
+// TestFillEndpointFieldsTagsEmbeddedHostPort is a regression test for
+// endpointField:"true" never actually landing on a monitor's Host/Port:
+// fillEndpointFields must find EndpointConfig's embedded Host and Port
+// fields, record them, and set their sentinel values, so
+// validateConfigWithDiscoveryRule can suppress `required` violations on
+// them ahead of discovery.
+func TestFillEndpointFieldsTagsEmbeddedHostPort(t *testing.T) {
+	conf := &discoveryAwareTestConfig{Name: "test"}
+
+	endpointFields := make(map[string]bool)
+	fillEndpointFields(reflect.ValueOf(conf).Elem(), endpointFields)
+
+	if !endpointFields["Host"] || !endpointFields["Port"] {
+		t.Fatalf("expected Host and Port to be recorded as endpoint fields, got %v", endpointFields)
+	}
+	if conf.Host != endpointHostSentinel {
+		t.Errorf("got Host %q, want sentinel %q", conf.Host, endpointHostSentinel)
+	}
+	if conf.Port != endpointPortSentinel {
+		t.Errorf("got Port %d, want sentinel %d", conf.Port, endpointPortSentinel)
+	}
+	// A non-endpoint required field is left untouched.
+	if conf.Name != "test" {
+		t.Errorf("got Name %q, want untouched %q", conf.Name, "test")
+	}
+}
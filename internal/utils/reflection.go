@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+)
+
+// YAMLNameOfFieldInStruct takes the Go field name reported by the
+// validator package (e.g. from a ValidationErrors entry) and looks up the
+// corresponding `yaml` struct tag on confStruct, so that validation
+// errors can be reported in terms of the config key users actually write
+// instead of internal Go field names. Falls back to the original field
+// name if confStruct isn't a (pointer to a) struct, the field can't be
+// found, or it has no yaml tag.
+func YAMLNameOfFieldInStruct(fieldName string, confStruct interface{}) string {
+	val := reflect.Indirect(reflect.ValueOf(confStruct))
+	if val.Kind() != reflect.Struct {
+		return fieldName
+	}
+
+	field, ok := val.Type().FieldByName(fieldName)
+	if !ok {
+		return fieldName
+	}
+
+	tag := field.Tag.Get("yaml")
+	if tag == "" {
+		return fieldName
+	}
+
+	// A yaml tag can carry options after a comma, e.g. `yaml:"host,omitempty"`.
+	return strings.SplitN(tag, ",", 2)[0]
+}